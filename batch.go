@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadBatchFile reads the RPCs of a -batch-file: a JSON or YAML list of payloads, or plain text with the
+// payloads separated by ]]>]]>.
+func loadBatchFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch file %s: %v", path, err)
+	}
+
+	var rpcs []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &rpcs); err != nil {
+			return nil, fmt.Errorf("failed to parse batch file %s: expected a JSON array of RPC strings: %v", path, err)
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &rpcs); err != nil {
+			return nil, fmt.Errorf("failed to parse batch file %s: expected a YAML list of RPC strings: %v", path, err)
+		}
+	default:
+		rpcs = strings.Split(string(data), "]]>]]>")
+	}
+
+	var out []string
+	for _, rpc := range rpcs {
+		if rpc = strings.TrimSpace(rpc); rpc != "" {
+			out = append(out, rpc)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("batch file %s contains no RPCs", path)
+	}
+	return out, nil
+}
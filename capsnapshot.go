@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// capabilitySnapshot is the saved form of a device's hello, used to run capability checks offline.
+type capabilitySnapshot struct {
+	Host         string    `json:"host"`
+	SessionID    string    `json:"session-id,omitempty"`
+	BaseVersion  string    `json:"base-version,omitempty"`
+	CapturedAt   time.Time `json:"captured-at"`
+	Capabilities []string  `json:"capabilities"`
+}
+
+func newCapabilitySnapshot(host, rawHello string) (*capabilitySnapshot, error) {
+	hello, err := netconf.ParseHello(rawHello)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &capabilitySnapshot{
+		Host:       host,
+		SessionID:  strings.TrimSpace(hello.SessionID),
+		CapturedAt: time.Now().UTC(),
+	}
+	for _, c := range hello.Capabilities {
+		snapshot.Capabilities = append(snapshot.Capabilities, strings.TrimSpace(c))
+	}
+	return snapshot, nil
+}
+
+func loadCapabilitySnapshot(path string) (*capabilitySnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities file %s: %v", path, err)
+	}
+
+	var snapshot capabilitySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities file %s: %v", path, err)
+	}
+	return &snapshot, nil
+}
+
+// checkOfflineCapabilities runs the -require-capability checks against a saved snapshot instead of a live device.
+func checkOfflineCapabilities(config Config) error {
+	snapshot, err := loadCapabilitySnapshot(config.CapabilitiesFrom)
+	if err != nil {
+		return err
+	}
+
+	if missing := netconf.MissingCapabilities(netconf.ParseCapabilities(snapshot.Capabilities), config.RequireCapabilities); len(missing) > 0 {
+		return fmt.Errorf("%s does not advertise required capabilities: %s", snapshot.Host, strings.Join(missing, ", "))
+	}
+	fmt.Printf("%s advertises all %d required capabilities\n", snapshot.Host, len(config.RequireCapabilities))
+	return nil
+}
+
+// loadSavedCapabilities reads capabilities saved earlier, either a -capabilities-only JSON snapshot
+// or the hello XML written by -save-capabilities.
+func loadSavedCapabilities(path string) ([]netconf.Capability, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capabilities file %s: %v", path, err)
+	}
+
+	var snapshot capabilitySnapshot
+	if json.Unmarshal(data, &snapshot) == nil {
+		return netconf.ParseCapabilities(snapshot.Capabilities), nil
+	}
+	hello, err := netconf.ParseHello(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities file %s as a JSON snapshot or hello XML: %v", path, err)
+	}
+	return netconf.ParseCapabilities(hello.Capabilities), nil
+}
+
+// formatCapabilityDiff renders a diff as one line per capability: + added, - removed, ~ changed.
+func formatCapabilityDiff(d netconf.CapabilityDiff) string {
+	if d.Empty() {
+		return "capabilities unchanged\n"
+	}
+
+	var b strings.Builder
+	for _, c := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", capabilityLabel(c))
+	}
+	for _, c := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", capabilityLabel(c))
+	}
+	for _, ch := range d.Changed {
+		var details []string
+		if ch.Old.Revision != ch.New.Revision {
+			details = append(details, fmt.Sprintf("revision %s -> %s", orNone(ch.Old.Revision), orNone(ch.New.Revision)))
+		}
+		details = append(details, listChanges("feature", ch.Old.Features, ch.New.Features)...)
+		details = append(details, listChanges("deviation", ch.Old.Deviations, ch.New.Deviations)...)
+		if ch.Old.Base != ch.New.Base {
+			details = append(details, fmt.Sprintf("namespace %s -> %s", ch.Old.Base, ch.New.Base))
+		}
+		name := ch.New.Module
+		if name == "" {
+			name = ch.New.Base
+		}
+		fmt.Fprintf(&b, "~ %s: %s\n", name, strings.Join(details, ", "))
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	return b.String()
+}
+
+// capabilityLabel names a YANG module capability as module@revision and anything else by its URI.
+func capabilityLabel(c netconf.Capability) string {
+	if c.Module == "" {
+		return c.URI
+	}
+	if c.Revision == "" {
+		return c.Module
+	}
+	return c.Module + "@" + c.Revision
+}
+
+// listChanges describes the entries added to and removed from a feature or deviation list.
+func listChanges(kind string, before, after []string) []string {
+	var out []string
+	for _, v := range after {
+		if !slices.Contains(before, v) {
+			out = append(out, fmt.Sprintf("+%s %s", kind, v))
+		}
+	}
+	for _, v := range before {
+		if !slices.Contains(after, v) {
+			out = append(out, fmt.Sprintf("-%s %s", kind, v))
+		}
+	}
+	return out
+}
+
+func orNone(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf"
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// TestCapabilitySnapshotRoundTrip captures a fake device's capabilities with -capabilities-only, loads the
+// file back, and runs -require-capability checks against it offline.
+func TestCapabilitySnapshotRoundTrip(t *testing.T) {
+	caps := []string{
+		netconftest.Base10, netconftest.Base11,
+		"urn:ietf:params:netconf:capability:candidate:1.0",
+		"urn:ietf:params:xml:ns:yang:ietf-interfaces?module=ietf-interfaces&amp;revision=2018-02-20&amp;features=arbitrary-names",
+	}
+	d := netconftest.NewDevice(caps...)
+	config := validConfig(func(c *Config) {
+		c.IP, c.File, c.CapabilitiesOnly = "127.0.0.1", "", true
+		c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	captureLog(t)
+
+	captured, err := runNetconfClient(config, &runMetrics{})
+	if err != nil {
+		t.Fatalf("runNetconfClient: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "caps.json")
+	if err := os.WriteFile(path, []byte(captured), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err := loadCapabilitySnapshot(path)
+	if err != nil {
+		t.Fatalf("loadCapabilitySnapshot: %v", err)
+	}
+	wantCaps := slices.Clone(caps)
+	wantCaps[3] = strings.ReplaceAll(wantCaps[3], "&amp;", "&")
+	if snapshot.Host != "127.0.0.1" || snapshot.SessionID != "42" || snapshot.BaseVersion != "1.1" ||
+		snapshot.CapturedAt.IsZero() || !slices.Equal(snapshot.Capabilities, wantCaps) {
+		t.Errorf("snapshot = %+v, want host 127.0.0.1, session-id 42, base 1.1 and capabilities %q", snapshot, wantCaps)
+	}
+	loaded, err := loadSavedCapabilities(path)
+	if err != nil {
+		t.Fatalf("loadSavedCapabilities: %v", err)
+	}
+	if want := netconf.ParseCapabilities(wantCaps); !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loaded capabilities = %+v, want %+v", loaded, want)
+	}
+
+	tests := []struct {
+		require []string
+		wantErr string
+	}{
+		{[]string{":candidate", "ietf-interfaces"}, ""},
+		{[]string{":candidate", ":validate", "ietf-system"}, "127.0.0.1 does not advertise required capabilities: :validate, ietf-system"},
+	}
+	for _, tt := range tests {
+		offline := validConfig(func(c *Config) { c.CapabilitiesFrom, c.RequireCapabilities = path, tt.require })
+		err := checkOfflineCapabilities(offline)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkOfflineCapabilities(%q): %v", tt.require, err)
+			}
+		} else if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("checkOfflineCapabilities(%q) error = %v, want %q", tt.require, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// maxDiffCells bounds the LCS table built for the differing middle section of two replies, about 16 MB of int32.
+const maxDiffCells = 4_000_000
+
+// runCompare runs the configured RPC against -ip and -compare-with and diffs the normalized replies.
+func runCompare(config Config) (string, error) {
+	hosts := []string{config.IP, config.CompareWith}
+	replies := make([]string, len(hosts))
+
+	for i, host := range hosts {
+		hostConfig := config
+		hostConfig.IP = host
+
+		var metrics runMetrics
+		reply, err := runNetconfClient(hostConfig, &metrics)
+		if err != nil {
+			return "", fmt.Errorf("device %s failed: %v", host, err)
+		}
+		reply, err = postProcess(hostConfig, reply)
+		if err != nil {
+			return "", fmt.Errorf("device %s failed: %v", host, err)
+		}
+		// one element per line whatever -indent or -compact say, so the diff points at the changed leaf
+		replies[i] = netconf.FormatXML(reply)
+	}
+
+	diff := diffLines(normalizeLines(replies[0]), normalizeLines(replies[1]))
+	if len(diff) == 0 {
+		return fmt.Sprintf("no differences between %s and %s", hosts[0], hosts[1]), nil
+	}
+	return fmt.Sprintf("--- %s\n+++ %s\n%s", hosts[0], hosts[1], strings.Join(diff, "\n")), nil
+}
+
+func normalizeLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// diffLines returns the lines only in a prefixed with "-" and the lines only in b prefixed with "+".
+func diffLines(a, b []string) []string {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	var out []string
+	if len(a)*len(b) > maxDiffCells {
+		// too big to align line by line, report the whole differing section
+		for _, line := range a {
+			out = append(out, "-"+line)
+		}
+		for _, line := range b {
+			out = append(out, "+"+line)
+		}
+		return out
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		out = append(out, "-"+a[i])
+	}
+	for ; j < len(b); j++ {
+		out = append(out, "+"+b[j])
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// configDevice is a fake device answering every rpc with a small interface config whose MTU is mtu.
+func configDevice(mtu string) *netconftest.Device {
+	d := netconftest.NewDevice()
+	d.Handle = func(rpc string) []string {
+		return []string{netconftest.Reply(rpc, `<data><interfaces><interface><name>eth0</name><mtu>`+mtu+
+			`</mtu><enabled>true</enabled></interface></interfaces></data>`)}
+	}
+	return d
+}
+
+func TestRunCompare(t *testing.T) {
+	// two loopback addresses on the same port, as -compare-with reuses -port
+	first, port, err := configDevice("1500").ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, _, err := configDevice("9000").ListenTLS("127.0.0.2:" + port)
+	if err != nil {
+		t.Skipf("cannot listen on a second loopback address: %v", err)
+	}
+	defer second.Close()
+	captureLog(t)
+
+	config := validConfig(func(c *Config) {
+		c.IP, c.CompareWith, c.File, c.Path = "127.0.0.1", "127.0.0.2", "", "<get-config><source><running/></source></get-config>"
+		c.Transport, c.Insecure, c.Port = "tls", true, port
+	})
+	for _, compact := range []bool{false, true} {
+		config.Compact = compact
+		diff, err := runCompare(config)
+		if err != nil {
+			t.Fatalf("runCompare: %v", err)
+		}
+		if want := "--- 127.0.0.1\n+++ 127.0.0.2\n-<mtu>1500</mtu>\n+<mtu>9000</mtu>"; diff != want {
+			t.Errorf("runCompare with compact %v =\n%s\nwant\n%s", compact, diff, want)
+		}
+	}
+
+	// nothing listens on 127.0.0.3, the error names that side
+	config.CompareWith = "127.0.0.3"
+	config.Timeout = 2
+	if _, err := runCompare(config); err == nil || !strings.HasPrefix(err.Error(), "device 127.0.0.3 failed") {
+		t.Errorf("runCompare error = %v, want it to name 127.0.0.3", err)
+	}
+}
+
+// TestDiffLines aligns a small differing section line by line, and reports a section too big for the LCS table
+// whole rather than building it.
+func TestDiffLines(t *testing.T) {
+	a := []string{"<a>", "<b>1</b>", "<c>2</c>", "<d>3</d>", "</a>"}
+	b := []string{"<a>", "<b>1</b>", "<c>4</c>", "<d>3</d>", "<e/>", "</a>"}
+	if got, want := diffLines(a, b), []string{"-<c>2</c>", "+<c>4</c>", "+<e/>"}; !slices.Equal(got, want) {
+		t.Errorf("diffLines = %q, want %q", got, want)
+	}
+
+	// every other line differs, so an aligned diff would be half as long as the fallback
+	var big, other []string
+	for i := 0; i < 2100; i++ {
+		big = append(big, fmt.Sprintf("<v>%d</v>", i))
+		if i%2 == 0 {
+			other = append(other, fmt.Sprintf("<v>%d</v>", i))
+		} else {
+			other = append(other, fmt.Sprintf("<w>%d</w>", i))
+		}
+	}
+	if got := diffLines(big, other); len(got) != 2*(len(big)-1) {
+		t.Errorf("diffLines over the table limit returned %d lines, want the whole %d-line section", len(got), 2*(len(big)-1))
+	}
+}
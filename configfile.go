@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// hostSettings are the connection settings a -config file may provide, named after their flags.
+type hostSettings struct {
+	Port           string `yaml:"port"`
+	Username       string `yaml:"username"`
+	Key            string `yaml:"key"`
+	Timeout        int    `yaml:"timeout"`
+	RPCTimeout     int    `yaml:"rpc-timeout"`
+	HostKeyPolicy  string `yaml:"host-key-policy"`
+	KnownHostsPath string `yaml:"known-hosts"`
+}
+
+// inventoryDevice is a named device in the -config file: its address plus settings overriding the defaults.
+type inventoryDevice struct {
+	IP           string `yaml:"ip"`
+	hostSettings `yaml:",inline"`
+}
+
+// fileConfig is the -config file: top-level defaults, per-host overrides keyed by address, and an inventory
+// of named devices and the groups they belong to.
+type fileConfig struct {
+	hostSettings `yaml:",inline"`
+	Hosts        map[string]hostSettings    `yaml:"hosts"`
+	Devices      map[string]inventoryDevice `yaml:"devices"`
+	Groups       map[string][]string        `yaml:"groups"`
+}
+
+func loadConfigFile(path string) (*fileConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var fc fileConfig
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return &fc, nil
+}
+
+// settingsFor merges the defaults with the overrides for host, then with those of the named device, if any.
+func (fc *fileConfig) settingsFor(host, name string) hostSettings {
+	s := fc.hostSettings
+	if o, ok := fc.Hosts[host]; ok {
+		s = s.merge(o)
+	}
+	if d, ok := fc.Devices[name]; ok && name != "" {
+		s = s.merge(d.hostSettings)
+	}
+	return s
+}
+
+// merge returns s with every setting o provides replaced.
+func (s hostSettings) merge(o hostSettings) hostSettings {
+	if o.Port != "" {
+		s.Port = o.Port
+	}
+	if o.Username != "" {
+		s.Username = o.Username
+	}
+	if o.Key != "" {
+		s.Key = o.Key
+	}
+	if o.Timeout != 0 {
+		s.Timeout = o.Timeout
+	}
+	if o.RPCTimeout != 0 {
+		s.RPCTimeout = o.RPCTimeout
+	}
+	if o.HostKeyPolicy != "" {
+		s.HostKeyPolicy = o.HostKeyPolicy
+	}
+	if o.KnownHostsPath != "" {
+		s.KnownHostsPath = o.KnownHostsPath
+	}
+	return s
+}
+
+// lookupDevice returns the address of the named inventory device.
+func (fc *fileConfig) lookupDevice(name string) (string, error) {
+	d, ok := fc.Devices[name]
+	if !ok {
+		return "", fmt.Errorf("device %q is not in the inventory", name)
+	}
+	if d.IP == "" {
+		return "", fmt.Errorf("inventory device %q has no ip", name)
+	}
+	return d.IP, nil
+}
+
+// expandGroup returns the devices of the named group, in the order the group lists them.
+func (fc *fileConfig) expandGroup(name string) ([]device, error) {
+	names, ok := fc.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("group %q is not in the inventory", name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("group %q is empty", name)
+	}
+	devices := make([]device, 0, len(names))
+	for _, n := range names {
+		ip, err := fc.lookupDevice(n)
+		if err != nil {
+			return nil, fmt.Errorf("group %q: %v", name, err)
+		}
+		devices = append(devices, device{Name: n, IP: ip})
+	}
+	return devices, nil
+}
+
+// explicitFlags returns the names of the flags given on the command line.
+func explicitFlags() map[string]bool {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyConfigFile fills in settings for host, or the inventory device name when not empty, from the -config file,
+// leaving flags given on the command line alone.
+func applyConfigFile(config *Config, host, name string) {
+	if config.fileConfig == nil {
+		return
+	}
+	s := config.fileConfig.settingsFor(host, name)
+	explicit := config.explicitFlags
+	if s.Port != "" && !explicit["port"] {
+		config.Port = s.Port
+	}
+	if s.Username != "" && !explicit["username"] {
+		config.Username = s.Username
+	}
+	if s.Key != "" && !explicit["key"] {
+		config.Key = s.Key
+	}
+	if s.Timeout != 0 && !explicit["timeout"] && !explicit["connect-timeout"] {
+		config.Timeout = s.Timeout
+	}
+	if s.RPCTimeout != 0 && !explicit["rpc-timeout"] {
+		config.RPCTimeout = s.RPCTimeout
+	}
+	if s.HostKeyPolicy != "" && !explicit["host-key-policy"] {
+		config.HostKeyPolicy = s.HostKeyPolicy
+	}
+	if s.KnownHostsPath != "" && !explicit["known-hosts"] {
+		config.KnownHostsPath = s.KnownHostsPath
+	}
+}
+
+// resolveDevice points the run at the address of the -device inventory entry.
+func resolveDevice(config *Config) error {
+	if config.Device == "" {
+		return nil
+	}
+	if config.IP != "" {
+		return fmt.Errorf("cannot specify both -ip and -device; choose one")
+	}
+	if config.fileConfig == nil {
+		return fmt.Errorf("-device requires a -config file with devices")
+	}
+	ip, err := config.fileConfig.lookupDevice(config.Device)
+	if err != nil {
+		return err
+	}
+	config.IP = ip
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const inventoryYAML = `
+username: ops
+port: "830"
+hosts:
+  10.0.0.2:
+    port: "2022"
+devices:
+  core-rtr-1:
+    ip: 10.0.0.1
+    username: netadmin
+  core-rtr-2:
+    ip: 10.0.0.2
+  edge-1:
+    port: "22"
+groups:
+  core: [core-rtr-1, core-rtr-2]
+  broken: [core-rtr-1, edge-1]
+  missing: [core-rtr-3]
+`
+
+// loadInventory writes inventoryYAML to a temporary -config file and loads it.
+func loadInventory(t *testing.T) *fileConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gonc.yaml")
+	if err := os.WriteFile(path, []byte(inventoryYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fc, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile: %v", err)
+	}
+	return fc
+}
+
+func TestResolveDevice(t *testing.T) {
+	fc := loadInventory(t)
+	config := Config{Device: "core-rtr-1", Username: "admin", Port: "830", fileConfig: fc}
+	if err := resolveDevice(&config); err != nil {
+		t.Fatalf("resolveDevice: %v", err)
+	}
+	applyConfigFile(&config, config.IP, config.Device)
+	if config.IP != "10.0.0.1" || config.Username != "netadmin" || config.Port != "830" {
+		t.Errorf("core-rtr-1 resolved to %s@%s:%s, want netadmin@10.0.0.1:830", config.Username, config.IP, config.Port)
+	}
+
+	// the per-address override still applies to a device reached by name
+	config = Config{Device: "core-rtr-2", fileConfig: fc}
+	if err := resolveDevice(&config); err != nil {
+		t.Fatalf("resolveDevice: %v", err)
+	}
+	applyConfigFile(&config, config.IP, config.Device)
+	if config.IP != "10.0.0.2" || config.Username != "ops" || config.Port != "2022" {
+		t.Errorf("core-rtr-2 resolved to %s@%s:%s, want ops@10.0.0.2:2022", config.Username, config.IP, config.Port)
+	}
+}
+
+func TestResolveDeviceErrors(t *testing.T) {
+	fc := loadInventory(t)
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"unknown name", Config{Device: "core-rtr-9", fileConfig: fc}, `device "core-rtr-9" is not in the inventory`},
+		{"entry without ip", Config{Device: "edge-1", fileConfig: fc}, `inventory device "edge-1" has no ip`},
+		{"with -ip", Config{Device: "core-rtr-1", IP: "10.0.0.5", fileConfig: fc}, "both -ip and -device"},
+		{"without -config", Config{Device: "core-rtr-1"}, "requires a -config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolveDevice(&tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("resolveDevice error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandGroup(t *testing.T) {
+	fc := loadInventory(t)
+	devices, err := fc.expandGroup("core")
+	if err != nil {
+		t.Fatalf("expandGroup: %v", err)
+	}
+	var got []string
+	for _, d := range devices {
+		got = append(got, d.Name+"="+d.IP)
+	}
+	if want := "core-rtr-1=10.0.0.1,core-rtr-2=10.0.0.2"; strings.Join(got, ",") != want {
+		t.Errorf("expandGroup(core) = %v, want %s", got, want)
+	}
+
+	for group, wantErr := range map[string]string{
+		"access":  `group "access" is not in the inventory`,
+		"broken":  `group "broken": inventory device "edge-1" has no ip`,
+		"missing": `group "missing": device "core-rtr-3" is not in the inventory`,
+	} {
+		if _, err := fc.expandGroup(group); err == nil || err.Error() != wantErr {
+			t.Errorf("expandGroup(%s) error = %v, want %q", group, err, wantErr)
+		}
+	}
+}
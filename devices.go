@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// device is one inventory entry; empty fields fall back to the command line flags. Name is set for the
+// named devices of a -group.
+type device struct {
+	Name     string `json:"-"`
+	IP       string `json:"ip"`
+	Port     string `json:"port"`
+	Username string `json:"username"`
+}
+
+// deviceResult is the outcome of running the RPC against one device.
+type deviceResult struct {
+	Device   device
+	Output   string
+	File     string
+	Err      error
+	Duration time.Duration
+}
+
+// errNotStarted marks the devices a fleet run never got to because it was interrupted.
+var errNotStarted = errors.New("not started, the run was interrupted")
+
+// loadDevices reads -devices: a JSON array of addresses or {ip, port, username} objects, a CSV file with an
+// ip column (port and username optional), or a plain list with one address per line and # comments.
+func loadDevices(path string) ([]device, error) {
+	var devices []device
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device inventory %s: %v", path, err)
+		}
+		var entries []json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse device inventory %s: %v", path, err)
+		}
+		for _, entry := range entries {
+			var d device
+			if err := json.Unmarshal(entry, &d.IP); err != nil {
+				if err := json.Unmarshal(entry, &d); err != nil {
+					return nil, fmt.Errorf("failed to parse device inventory %s: %v", path, err)
+				}
+			}
+			devices = append(devices, d)
+		}
+	case ".csv":
+		rows, err := readCSVRows(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			devices = append(devices, device{IP: row["ip"], Port: row["port"], Username: row["username"]})
+		}
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read device inventory %s: %v", path, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			if line = strings.TrimSpace(line); line != "" {
+				devices = append(devices, device{IP: line})
+			}
+		}
+	}
+
+	for i, d := range devices {
+		if strings.TrimSpace(d.IP) == "" {
+			return nil, fmt.Errorf("device inventory %s: entry %d has no ip", path, i+1)
+		}
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("device inventory %s is empty", path)
+	}
+	return devices, nil
+}
+
+// label names the device in the summary and its output file: the inventory name when it has one.
+func (d device) label() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.IP
+}
+
+// fleetDevices returns the devices of a fleet run: the -group members from the -config inventory, or -devices.
+func fleetDevices(config Config) ([]device, error) {
+	if config.Group != "" {
+		if config.fileConfig == nil {
+			return nil, fmt.Errorf("-group requires a -config file with groups")
+		}
+		return config.fileConfig.expandGroup(config.Group)
+	}
+	return loadDevices(config.Devices)
+}
+
+// runDevice runs the configured RPC against a single device and returns the post-processed output.
+func runDevice(config Config, d device) deviceResult {
+	config.IP = d.IP
+	applyConfigFile(&config, d.IP, d.Name)
+	if d.Port != "" {
+		config.Port = d.Port
+	}
+	if d.Username != "" {
+		config.Username = d.Username
+	}
+
+	start := time.Now()
+	var metrics runMetrics
+	output, err := runNetconfClient(config, &metrics)
+	if err == nil {
+		output, err = postProcess(config, output)
+	}
+	if err == nil {
+		output, err = convertOutput(config, output)
+	}
+	return deviceResult{Device: d, Output: output, Err: err, Duration: time.Since(start)}
+}
+
+// aggregateEntry is one device in the -aggregate json document.
+type aggregateEntry struct {
+	Status     string          `json:"status"` // ok, failed or skipped
+	DurationMS int64           `json:"duration-ms"`
+	Reply      json.RawMessage `json:"reply,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// fleetAggregate collects the results of a fleet run into one document keyed by device, as they complete.
+type fleetAggregate struct {
+	mu      sync.Mutex
+	devices map[string]aggregateEntry
+}
+
+func newFleetAggregate() *fleetAggregate {
+	return &fleetAggregate{devices: map[string]aggregateEntry{}}
+}
+
+// add records r, whose Output is the reply already converted to JSON.
+func (a *fleetAggregate) add(r deviceResult) {
+	entry := aggregateEntry{Status: "ok", DurationMS: r.Duration.Milliseconds()}
+	switch {
+	case errors.Is(r.Err, errNotStarted):
+		entry.Status, entry.Error = "skipped", r.Err.Error()
+	case r.Err != nil:
+		entry.Status, entry.Error = "failed", r.Err.Error()
+	default:
+		entry.Reply = json.RawMessage(r.Output)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := r.Device.label()
+	// the same address may be listed twice, e.g. on different ports
+	for n := 2; ; n++ {
+		if _, taken := a.devices[key]; !taken {
+			break
+		}
+		key = fmt.Sprintf("%s#%d", r.Device.label(), n)
+	}
+	a.devices[key] = entry
+}
+
+func (a *fleetAggregate) write(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data, err := json.MarshalIndent(a.devices, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the aggregate: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
+
+// runDevices runs the RPC against every device in -devices or -group with at most -concurrency sessions at a
+// time, writing one file per device to -output-dir, or with -aggregate json a single document to -output.
+// Once ctx is cancelled no further device is started; the sessions in flight run to completion, and the devices
+// left out are reported with errNotStarted.
+func runDevices(ctx context.Context, config Config) ([]deviceResult, error) {
+	devices, err := fleetDevices(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var aggregate *fleetAggregate
+	output := config.Output
+	if config.Aggregate != "" {
+		aggregate = newFleetAggregate()
+		// -output is the aggregate, not a per-device setting
+		config.Format, config.Output = "json", ""
+	} else if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory %s: %v", config.OutputDir, err)
+	}
+
+	results := make([]deviceResult, len(devices))
+	sem := make(chan struct{}, config.Concurrency)
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		if !acquireSlot(ctx, sem) {
+			results[i] = deviceResult{Device: d, Err: errNotStarted}
+			if aggregate != nil {
+				aggregate.add(results[i])
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = runDevice(config, d)
+			if aggregate != nil {
+				aggregate.add(results[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	if aggregate != nil {
+		if err := aggregate.write(output); err != nil {
+			return nil, err
+		}
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].File = output
+			}
+		}
+		return results, nil
+	}
+
+	ext := config.Format
+	if ext == "" {
+		ext = "xml"
+	}
+	taken := map[string]bool{}
+	for i := range results {
+		r := &results[i]
+		if r.Err != nil {
+			continue
+		}
+		// numbered like the aggregate keys, so a device listed twice doesn't overwrite the first one's reply
+		base := strings.NewReplacer(":", "_", "/", "_").Replace(r.Device.label())
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s#%d", base, n)
+		}
+		taken[name] = true
+		r.File = filepath.Join(config.OutputDir, name+"."+ext)
+		if err := os.WriteFile(r.File, []byte(r.Output), 0644); err != nil {
+			r.Err = fmt.Errorf("failed to write %s: %v", r.File, err)
+			r.File = ""
+		}
+	}
+	return results, nil
+}
+
+// acquireSlot waits for a free slot in sem, giving up once ctx is cancelled.
+func acquireSlot(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		if ctx.Err() != nil {
+			<-sem
+			return false
+		}
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// formatSummary renders one line per device with its status, duration and output file or error, noting when
+// the run was interrupted.
+func formatSummary(results []deviceResult, interrupted bool) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE\tSTATUS\tDURATION\tRESULT")
+	failed, skipped := 0, 0
+	for _, r := range results {
+		if errors.Is(r.Err, errNotStarted) {
+			skipped++
+			fmt.Fprintf(w, "%s\tSKIPPED\t-\t%v\n", r.Device.label(), r.Err)
+		} else if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\tFAILED\t%v\t%v\n", r.Device.label(), r.Duration.Round(time.Millisecond), r.Err)
+		} else {
+			fmt.Fprintf(w, "%s\tOK\t%v\t%s\n", r.Device.label(), r.Duration.Round(time.Millisecond), r.File)
+		}
+	}
+	w.Flush()
+	if interrupted {
+		fmt.Fprintf(&b, "interrupted: partial results, %d of %d devices not started\n", skipped, len(results))
+	}
+	fmt.Fprintf(&b, "%d of %d devices succeeded\n", len(results)-failed-skipped, len(results))
+	return b.String()
+}
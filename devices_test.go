@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// TestRunDevicesInterrupted cancels a fleet run while the first of four devices is in its RPC: that device
+// completes, the other three are never started, and the summary says so.
+func TestRunDevicesInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := netconftest.NewDevice()
+	d.Handle = func(rpc string) []string {
+		cancel()
+		return []string{netconftest.Reply(rpc, "<data/>")}
+	}
+	ln, port, err := d.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "devices.txt")
+	if err := os.WriteFile(inventory, []byte(strings.Repeat("127.0.0.1\n", 4)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := validConfig(func(c *Config) {
+		c.IP, c.File, c.Path = "", "", "<get/>"
+		c.Devices, c.Concurrency, c.OutputDir = inventory, 1, filepath.Join(dir, "results")
+		c.Transport, c.Insecure, c.Port = "tls", true, port
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	captureLog(t)
+
+	results, err := runDevices(ctx, config)
+	if err != nil {
+		t.Fatalf("runDevices: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d results, want 4", len(results))
+	}
+	if results[0].Err != nil || results[0].File == "" {
+		t.Errorf("device in flight = %+v, want it to complete", results[0])
+	}
+	for _, r := range results[1:] {
+		if !errors.Is(r.Err, errNotStarted) {
+			t.Errorf("device after the interrupt = %+v, want errNotStarted", r)
+		}
+	}
+	gets := 0
+	for _, rpc := range d.Requests() {
+		if strings.Contains(rpc, "<get/>") {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("device received %d get rpcs, want 1", gets)
+	}
+
+	summary := formatSummary(results, ctx.Err() != nil)
+	for _, want := range []string{"127.0.0.1  SKIPPED", "interrupted: partial results, 3 of 4 devices not started", "1 of 4 devices succeeded"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary lacks %q:\n%s", want, summary)
+		}
+	}
+}
+
+// TestRunDevicesDuplicateAddress lists the same address twice and checks each run gets its own output file.
+func TestRunDevicesDuplicateAddress(t *testing.T) {
+	d := netconftest.NewDevice()
+	d.Handle = func(rpc string) []string { return []string{netconftest.Reply(rpc, "<data/>")} }
+	ln, port, err := d.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "devices.txt")
+	if err := os.WriteFile(inventory, []byte("127.0.0.1\n127.0.0.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := filepath.Join(dir, "results")
+	config := validConfig(func(c *Config) {
+		c.IP, c.File, c.Path = "", "", "<get/>"
+		c.Devices, c.Concurrency, c.OutputDir = inventory, 2, outputDir
+		c.Transport, c.Insecure, c.Port = "tls", true, port
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	captureLog(t)
+
+	results, err := runDevices(context.Background(), config)
+	if err != nil {
+		t.Fatalf("runDevices: %v", err)
+	}
+	want := []string{filepath.Join(outputDir, "127.0.0.1.xml"), filepath.Join(outputDir, "127.0.0.1#2.xml")}
+	if len(results) != 2 || results[0].File != want[0] || results[1].File != want[1] {
+		t.Fatalf("results = %+v, want files %q", results, want)
+	}
+	for _, path := range want {
+		if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "rpc-reply") {
+			t.Errorf("%s = %q, %v; want the reply", path, data, err)
+		}
+	}
+}
+
+// TestRunDevicesAggregate runs a -group of three fake devices, one answering with an rpc-error, into a single
+// -aggregate json document.
+func TestRunDevicesAggregate(t *testing.T) {
+	fc := &fileConfig{Devices: map[string]inventoryDevice{}, Groups: map[string][]string{}}
+	for _, name := range []string{"rtr-a", "rtr-b", "rtr-c"} {
+		d := netconftest.NewDevice()
+		d.Handle = func(rpc string) []string {
+			if name == "rtr-c" {
+				return []string{netconftest.Reply(rpc, netconftest.RPCError("operation-failed", "rejected"))}
+			}
+			return []string{netconftest.Reply(rpc, `<data><system xmlns="urn:example"><hostname>`+name+`</hostname></system></data>`)}
+		}
+		ln, port, err := d.ListenTLS("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		fc.Devices[name] = inventoryDevice{IP: "127.0.0.1", hostSettings: hostSettings{Port: port}}
+		fc.Groups["core"] = append(fc.Groups["core"], name)
+	}
+
+	output := filepath.Join(t.TempDir(), "fleet.json")
+	config := validConfig(func(c *Config) {
+		c.IP, c.File, c.Path = "", "", "<get/>"
+		c.ConfigFile, c.Group, c.fileConfig = "gonc.yaml", "core", fc
+		c.Aggregate, c.Output, c.Concurrency = "json", output, 3
+		c.Transport, c.Insecure = "tls", true
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	captureLog(t)
+
+	results, err := runDevices(context.Background(), config)
+	if err != nil {
+		t.Fatalf("runDevices: %v", err)
+	}
+	if len(results) != 3 || results[0].File != output || results[2].Err == nil {
+		t.Fatalf("results = %+v, want rtr-a and rtr-b written to %s and rtr-c failed", results, output)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]struct {
+		Status string `json:"status"`
+		Reply  struct {
+			RPCReply struct {
+				Data struct {
+					System struct {
+						Hostname string `json:"hostname"`
+					} `json:"system"`
+				} `json:"data"`
+			} `json:"rpc-reply"`
+		} `json:"reply"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("aggregate is not valid JSON: %v\n%s", err, data)
+	}
+	for _, name := range []string{"rtr-a", "rtr-b"} {
+		if e := doc[name]; e.Status != "ok" || e.Reply.RPCReply.Data.System.Hostname != name {
+			t.Errorf("%s = %+v, want ok with hostname %s\n%s", name, e, name, data)
+		}
+	}
+	if e := doc["rtr-c"]; e.Status != "failed" || !strings.Contains(e.Error, "operation-failed") {
+		t.Errorf("rtr-c = %+v, want failed with the rpc-error", e)
+	}
+}
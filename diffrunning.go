@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// runDiffRunning connects and runs -diff-running; see previewChange.
+func runDiffRunning(config Config) (string, error) {
+	payload, err := getRPCPayload(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config payload: %v", err)
+	}
+
+	ncEndPoint := newEndpoint(config)
+	if err := ncEndPoint.ConnectWithRetry(context.Background(), config.Retries+1, config.RetryBackoff); err != nil {
+		return "", err
+	}
+	defer ncEndPoint.Disconnect()
+	return previewChange(config, ncEndPoint, payload)
+}
+
+// previewChange loads configXML into the locked candidate, diffs the candidate against running, and then commits
+// with -yes or discards the edit. It returns the diff followed by what was done with it. A failed edit is
+// discarded too, so the candidate is never left half-changed.
+func previewChange(config Config, s *netconf.Endpoint, configXML string) (string, error) {
+	if !s.HasCapability(":candidate") {
+		return "", fmt.Errorf("-diff-running needs the candidate datastore, which the device does not advertise (no :candidate capability)")
+	}
+
+	var preview string
+	err := s.WithLock("candidate", func() error {
+		diff, err := candidateDiff(s, configXML)
+		if err != nil {
+			if dErr := s.DiscardChanges(); dErr != nil {
+				logger.Warn("failed to discard the candidate", "error", dErr)
+			}
+			return err
+		}
+		switch {
+		case diff == "":
+			preview = "no differences between running and candidate; nothing to commit\n"
+			return s.DiscardChanges()
+		case config.Yes:
+			preview = diff + "\nCommitted.\n"
+			return s.Commit()
+		default:
+			preview = diff + "\nDiscarded; rerun with -yes to commit.\n"
+			return s.DiscardChanges()
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return preview, nil
+}
+
+// candidateDiff applies configXML to the candidate and returns its differences from running, "" when none.
+func candidateDiff(s *netconf.Endpoint, configXML string) (string, error) {
+	if _, err := s.EditConfig("candidate", configXML, netconf.EditConfigOptions{}); err != nil {
+		return "", fmt.Errorf("edit-config of the candidate failed: %w", err)
+	}
+
+	var trees []string
+	for _, datastore := range []string{"running", "candidate"} {
+		reply, err := s.GetConfig(datastore, "")
+		if err != nil {
+			return "", fmt.Errorf("get-config of %s failed: %w", datastore, err)
+		}
+		// message-ids differ between the two replies, compare the data only
+		data, err := netconf.UnwrapReply(reply)
+		if err != nil {
+			return "", fmt.Errorf("get-config of %s: %v", datastore, err)
+		}
+		trees = append(trees, netconf.FormatXML(data))
+	}
+
+	diff := diffLines(normalizeLines(trees[0]), normalizeLines(trees[1]))
+	if len(diff) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("--- running\n+++ candidate\n%s", strings.Join(diff, "\n")), nil
+}
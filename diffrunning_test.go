@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// TestPreviewChange runs -diff-running against a device whose candidate gains an interface once edited.
+func TestPreviewChange(t *testing.T) {
+	const running = `<interfaces xmlns="urn:example"><interface><name>eth0</name><mtu>1500</mtu></interface></interfaces>`
+	const candidate = `<interfaces xmlns="urn:example"><interface><name>eth0</name><mtu>9000</mtu></interface></interfaces>`
+
+	tests := []struct {
+		name     string
+		yes      bool
+		edited   bool
+		wantRPC  string
+		wantText string
+	}{
+		{"preview discards", false, true, "<discard-changes/>", "Discarded; rerun with -yes to commit."},
+		{"yes commits", true, true, "<commit/>", "Committed."},
+		{"no change", true, false, "<discard-changes/>", "nothing to commit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := netconftest.NewDevice(netconftest.Base10, candidateCapability)
+			d.Handle = func(rpc string) []string {
+				switch {
+				case strings.Contains(rpc, "<source><candidate/>") && tt.edited:
+					return []string{netconftest.Reply(rpc, "<data>"+candidate+"</data>")}
+				case strings.Contains(rpc, "<get-config>"):
+					return []string{netconftest.Reply(rpc, "<data>"+running+"</data>")}
+				}
+				return nil
+			}
+			s := connectFakeDevice(t, d)
+
+			preview, err := previewChange(validConfig(func(c *Config) { c.Yes = tt.yes }), s, `<interfaces xmlns="urn:example"/>`)
+			if err != nil {
+				t.Fatalf("previewChange: %v", err)
+			}
+			if !strings.Contains(preview, tt.wantText) {
+				t.Errorf("preview lacks %q:\n%s", tt.wantText, preview)
+			}
+			if tt.edited && (!strings.Contains(preview, "-<mtu>1500</mtu>") || !strings.Contains(preview, "+<mtu>9000</mtu>")) {
+				t.Errorf("preview does not show the mtu change:\n%s", preview)
+			}
+
+			var ops []string
+			for _, rpc := range d.Requests() {
+				for _, op := range []string{"<lock>", "<edit-config>", "<source><running/>", "<source><candidate/>", "<commit/>", "<discard-changes/>", "<unlock>"} {
+					if strings.Contains(rpc, op) {
+						ops = append(ops, op)
+					}
+				}
+			}
+			want := []string{"<lock>", "<edit-config>", "<source><running/>", "<source><candidate/>", tt.wantRPC, "<unlock>"}
+			if strings.Join(ops, ",") != strings.Join(want, ",") {
+				t.Errorf("device received %v, want %v", ops, want)
+			}
+		})
+	}
+}
+
+func TestPreviewChangeNeedsCandidate(t *testing.T) {
+	d := netconftest.NewDevice(netconftest.Base10)
+	s := connectFakeDevice(t, d)
+	_, err := previewChange(validConfig(func(*Config) {}), s, `<interfaces xmlns="urn:example"/>`)
+	if err == nil || !strings.Contains(err.Error(), "no :candidate capability") {
+		t.Fatalf("previewChange error = %v, want it to name the missing :candidate capability", err)
+	}
+	if len(d.Requests()) != 0 {
+		t.Errorf("device received %v, want nothing", d.Requests())
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runDryRun builds and checks the RPCs the configured run would send and prints them instead of connecting.
+func runDryRun(config Config) error {
+	rpcs, _, err := buildRPCs(config)
+	if err != nil {
+		return err
+	}
+
+	ncEndPoint := newEndpoint(config)
+	var out []string
+	for i, rpc := range rpcs {
+		rpc = ncEndPoint.PrepareRPC(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rpc), "]]>]]>")))
+		if err := checkWellFormed(rpc); err != nil {
+			return fmt.Errorf("RPC %d of %d is not well-formed XML: %v", i+1, len(rpcs), err)
+		}
+		out = append(out, rpc)
+	}
+
+	output := strings.Join(out, "\n") + "\n"
+	if config.Output != "" {
+		if err := os.WriteFile(config.Output, []byte(output), 0644); err != nil {
+			return fmt.Errorf("failed to write dry run to file %s: %v", config.Output, err)
+		}
+		fmt.Printf("Dry run written to %s\n", config.Output)
+		return nil
+	}
+	fmt.Print(output)
+	return nil
+}
+
+// checkWellFormed parses the whole payload, which the device would otherwise be the first to reject.
+func checkWellFormed(payload string) error {
+	decoder := xml.NewDecoder(strings.NewReader(payload))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// fixture is a self-contained record of a session: the server hello and each request with its reply as
+// received, framing removed. netconftest.LoadFixture turns it into a fake device replaying the replies.
+type fixture struct {
+	Host        string            `json:"host"`
+	Hello       string            `json:"hello"`
+	BaseVersion string            `json:"base-version"`
+	Exchanges   []fixtureExchange `json:"exchanges"`
+}
+
+type fixtureExchange struct {
+	Request string `json:"request"`
+	Reply   string `json:"reply"`
+}
+
+func writeFixture(path string, fx *fixture) error {
+	data, err := json.MarshalIndent(fx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixture: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fixture %s: %v", path, err)
+	}
+	return nil
+}
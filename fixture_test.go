@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf"
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// TestEmitFixtureRoundTrip records a session with -emit-fixture, loads the fixture into a fake device and checks
+// the replayed session matches the recorded one.
+func TestEmitFixtureRoundTrip(t *testing.T) {
+	var sent string
+	d := netconftest.NewDevice()
+	d.SessionID = "7"
+	d.Handle = func(rpc string) []string {
+		sent = netconftest.Reply(rpc, `<data><system><hostname>r1</hostname></system></data>`)
+		return []string{sent}
+	}
+	path := filepath.Join(t.TempDir(), "session.json")
+	config := validConfig(func(c *Config) {
+		c.IP, c.File, c.Path = "127.0.0.1", "", "<get-config><source><running/></source></get-config>"
+		c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+		c.EmitFixture = path
+	})
+	captureLog(t)
+	if _, err := runNetconfClient(config, &runMetrics{}); err != nil {
+		t.Fatalf("runNetconfClient: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	replay, err := netconftest.LoadFixture(f)
+	if err != nil {
+		t.Fatalf("LoadFixture: %v", err)
+	}
+	s := connectFakeDevice(t, replay)
+	if want := d.Hello(); s.Capabilities != want {
+		t.Errorf("replayed hello = %q, want %q", s.Capabilities, want)
+	}
+	if s.SessionID() != 7 {
+		t.Errorf("replayed SessionID() = %d, want 7", s.SessionID())
+	}
+	reply, err := s.Run(d.Requests()[0])
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if reply != sent {
+		t.Errorf("replayed reply = %q, want the recorded %q", reply, sent)
+	}
+
+	// the fixture holds one exchange, anything after it is refused
+	var rpcErr *netconf.RPCError
+	if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); !errors.As(err, &rpcErr) {
+		t.Errorf("Run past the recording error = %v, want an rpc-error", err)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runGetSchema downloads every -get-schema module, given as name or name@revision, into -schema-dir.
+func runGetSchema(config Config) error {
+	ncEndPoint := newEndpoint(config)
+	if err := ncEndPoint.ConnectWithRetry(context.Background(), config.Retries+1, config.RetryBackoff); err != nil {
+		return err
+	}
+	defer ncEndPoint.Disconnect()
+
+	if err := os.MkdirAll(config.SchemaDir, 0755); err != nil {
+		return fmt.Errorf("failed to create schema directory %s: %v", config.SchemaDir, err)
+	}
+	for _, module := range config.GetSchema {
+		name, revision, _ := strings.Cut(module, "@")
+		text, err := ncEndPoint.GetSchema(name, revision, "yang")
+		if err != nil {
+			return fmt.Errorf("failed to download schema %s: %w", module, err)
+		}
+		path := filepath.Join(config.SchemaDir, module+".yang")
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return fmt.Errorf("failed to write schema %s: %v", path, err)
+		}
+		fmt.Printf("Schema %s written to %s\n", module, path)
+	}
+	return nil
+}
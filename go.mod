@@ -2,6 +2,14 @@ module github.com/naseriax/gonc
 
 go 1.23.4
 
-require golang.org/x/crypto v0.36.0
+require (
+	golang.org/x/crypto v0.36.0
+	golang.org/x/net v0.38.0
+	golang.org/x/term v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require golang.org/x/sys v0.31.0 // indirect
+require (
+	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
+)
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// lockRetryInterval is how often -wait-for-lock retries a datastore locked by another session.
+var lockRetryInterval = 2 * time.Second
+
+// checkLock makes sure no other session holds the datastore lock before an edit, by taking the lock and
+// releasing it again. A lock held elsewhere is retried every lockRetryInterval until wait has passed; then, or
+// straight away when wait is zero, the *netconf.LockError naming the holding session is returned.
+func checkLock(s *netconf.Endpoint, datastore string, wait time.Duration) error {
+	deadline := time.Now().Add(wait)
+	for {
+		err := s.Lock(datastore)
+		if err == nil {
+			return s.Unlock(datastore)
+		}
+		var lockErr *netconf.LockError
+		if !errors.As(err, &lockErr) {
+			return fmt.Errorf("failed to check the %s lock: %w", datastore, err)
+		}
+		if wait <= 0 {
+			return fmt.Errorf("%w, not sending the RPC", err)
+		}
+		if time.Now().Add(lockRetryInterval).After(deadline) {
+			return fmt.Errorf("%w after waiting %v, not sending the RPC", err, wait)
+		}
+		logger.Info("datastore locked by another session, waiting", "datastore", datastore, "session-id", lockErr.SessionID)
+		time.Sleep(lockRetryInterval)
+	}
+}
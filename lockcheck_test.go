@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naseriax/gonc/netconf"
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+// lockDenied is the rpc-error a device returns to <lock> while session 7 holds the lock.
+const lockDenied = `<rpc-error><error-type>protocol</error-type><error-tag>lock-denied</error-tag>` +
+	`<error-severity>error</error-severity><error-info><session-id>7</session-id></error-info>` +
+	`<error-message>Lock failed, lock is already held</error-message></rpc-error>`
+
+func TestCheckLock(t *testing.T) {
+	previous := lockRetryInterval
+	lockRetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { lockRetryInterval = previous })
+
+	tests := []struct {
+		name      string
+		denials   int // how many <lock> attempts are denied before the lock is free
+		wait      time.Duration
+		wantErr   string
+		wantLocks int // 0 when timing decides, as long as it retried
+	}{
+		{"free", 0, 0, "", 1},
+		{"held, no wait", 1, 0, "running datastore is locked by session 7, not sending the RPC", 1},
+		{"released while waiting", 2, time.Second, "", 3},
+		{"held past the wait", 100, 35 * time.Millisecond, "running datastore is locked by session 7 after waiting 35ms", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := netconftest.NewDevice()
+			locks := 0
+			d.Handle = func(rpc string) []string {
+				if strings.Contains(rpc, "<lock>") {
+					locks++
+					if locks <= tt.denials {
+						return []string{netconftest.Reply(rpc, lockDenied)}
+					}
+				}
+				return nil
+			}
+			s := connectFakeDevice(t, d)
+			captureLog(t)
+
+			err := checkLock(s, "running", tt.wait)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkLock: %v", err)
+				}
+			} else {
+				var lockErr *netconf.LockError
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("checkLock error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				if !errors.As(err, &lockErr) || lockErr.SessionID != "7" || exitCode(err) != exitRPCError {
+					t.Errorf("checkLock error = %#v, want a LockError naming session 7", err)
+				}
+			}
+			if (tt.wantLocks == 0 && locks < 2) || (tt.wantLocks > 0 && locks != tt.wantLocks) {
+				t.Errorf("device received %d lock attempts, want %d", locks, tt.wantLocks)
+			}
+			unlocks := 0
+			for _, rpc := range d.Requests() {
+				if strings.Contains(rpc, "<unlock>") {
+					unlocks++
+				}
+			}
+			if want := map[bool]int{true: 1, false: 0}[tt.wantErr == ""]; unlocks != want {
+				t.Errorf("device received %d unlocks, want %d", unlocks, want)
+			}
+		})
+	}
+}
@@ -2,41 +2,277 @@ package main
 
 import (
 	"bytes"
-	"encoding/xml"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/naseriax/gonc/netconf"
+	"golang.org/x/crypto/ssh"
+)
+
+// logger receives the CLI's and the sessions' diagnostics at the -log-level threshold.
+var logger = slog.Default()
+
+// Exit codes, so scripts can tell a device rejecting an RPC apart from gonc failing to reach it.
+const (
+	exitFailure  = 1 // transport, usage and local errors
+	exitRPCError = 2 // the reply carried an rpc-error with severity error
 )
 
+// exitCode picks the exit code for err: exitRPCError for a device rpc-error, exitFailure otherwise.
+func exitCode(err error) int {
+	var rpcErr *netconf.RPCError
+	if errors.As(err, &rpcErr) {
+		return exitRPCError
+	}
+	var stepsErr *stepsFailedError
+	if errors.As(err, &stepsErr) && stepsErr.RPCErrors == len(stepsErr.Failed) {
+		return exitRPCError
+	}
+	return exitFailure
+}
+
+// wireLog receives the raw NETCONF traffic with -debug-wire, nil otherwise.
+var wireLog io.Writer
+
 type Config struct {
-	IP       string
-	Port     string
-	Username string
-	Password string
-	Path     string
-	File     string
-	Output   string
-	Key      string
-	Filter   string
-	Timeout  int
+	IP            string
+	Port          string
+	Username      string
+	Password      string
+	PasswordEnv   string
+	Path          string
+	NoWrap        bool
+	DryRun        bool
+	ContinueOnErr bool
+	File          string
+	Output        string
+	Key           string
+	KeyPassphrase string
+	UseAgent      bool
+	Filters       stringList
+	Timeout       int
+	RPCTimeout    int
+	Keepalive     int
+	LogLevel      string
+	Verbose       bool
+	DebugWire     bool
+	DebugWireFile string
+	Retries       int
+	RetryBackoff  time.Duration
+
+	OutputFormat  string
+	Raw           bool
+	Format        string
+	KeepDelimiter bool
+	StrictHello   bool
+	MetricsFile   string
+	Unwrap        bool
+	Indent        string
+	Compact       bool
+
+	HostKeyPolicy  string
+	KnownHostsPath string
+	Insecure       bool
+
+	JumpHost     string
+	JumpKey      string
+	JumpPassword string
+
+	Transport  string
+	CAFile     string
+	ClientCert string
+	ClientKey  string
+
+	GetData      string
+	OriginFilter string
+	WithOrigin   bool
+	WithDefaults string
+
+	StrictFilter  bool
+	KeepAncestors bool
+
+	NetconfCommand string
+	KeyAlgorithm   string
+	Ciphers        string
+	KeyExchanges   string
+	MACs           string
+	HostKeyAlgos   string
+	Legacy         bool
+
+	Template  string
+	CSV       string
+	BatchRows int
+	BatchFile string
+	Playbook  string
+
+	DiffRunning bool
+	Yes         bool
+	CheckLock   string
+	WaitForLock time.Duration
+
+	Streams   bool
+	Subscribe string
+
+	GetSchema stringList
+	SchemaDir string
+
+	MaxHelloBytes int
+
+	SaveCapabilities    string
+	CapabilitiesOnError bool
+
+	FileEncoding string
+	StreamFile   bool
+
+	RequestPty bool
+	PtyTerm    string
+	PtyWidth   int
+	PtyHeight  int
+
+	CapabilitiesOnly    bool
+	DiffCapabilities    string
+	CapabilitiesFrom    string
+	RequireCapabilities stringList
+
+	ConfigFile   string
+	Device       string
+	Group        string
+	Devices      string
+	Aggregate    string
+	Concurrency  int
+	ProbeSubnet  string
+	ProbeTimeout int
+	OutputDir    string
+	CompareWith  string
+	EmitFixture  string
+
+	TemplatesDir string
+	RPCTemplate  string
+	Vars         stringList
+
+	fileConfig    *fileConfig
+	explicitFlags map[string]bool
 }
 
 func main() {
 	defer customPanicHandler()
 
 	config := Config{}
-	flag.StringVar(&config.IP, "ip", "", "IP address of the NETCONF device (required)")
+	flag.StringVar(&config.IP, "ip", "", "IPv4/IPv6 address or hostname of the NETCONF device (required); ssh-style user@host:port also sets the user and port unless -username/-port are given")
 	flag.StringVar(&config.Port, "port", "830", "Port number for NETCONF connection")
 	flag.StringVar(&config.Username, "username", "admin", "Username for authentication")
-	flag.StringVar(&config.Password, "password", "", "Password for authentication (required)")
-	flag.StringVar(&config.File, "file", "", "Path to XML file containing NETCONF RPC payload")
+	flag.StringVar(&config.Password, "password", "", "Password for authentication; prompted for on a terminal when not given")
+	flag.StringVar(&config.PasswordEnv, "password-env", "", "Read the password from this environment variable instead of -password")
+	flag.StringVar(&config.Path, "path", "", "Inline RPC payload; a bare operation such as <get-config> is wrapped in an <rpc> envelope")
+	flag.StringVar(&config.File, "file", "", "Path to XML file containing NETCONF RPC payload; a comma-separated list or glob runs each file in order over one session")
+	flag.BoolVar(&config.ContinueOnErr, "continue-on-error", false, "With several -file or -batch-file RPCs, carry on after a failing step and report all failures at the end")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "Print the RPC(s) exactly as they would be sent, envelope and message-id included, without connecting")
+	flag.BoolVar(&config.NoWrap, "no-wrap", false, "Send -path/-file/-batch-file payloads exactly as given, without adding a missing <rpc> envelope")
+	flag.StringVar(&config.FileEncoding, "file-encoding", "", "Encoding of the -file payload: base64 or hex (default: plain XML)")
+	flag.BoolVar(&config.StreamFile, "stream-file", false, "Stream the -file payload to the device in bounded chunks instead of loading it into memory (for very large edit-configs)")
 	flag.StringVar(&config.Output, "output", "", "Path to output file for NETCONF response (optional)")
-	flag.StringVar(&config.Filter, "filter", "", "start-with xpath filtering only for the last element")
+	flag.Var(&config.Filters, "filter", "XPath-like filter on the last element: start-with, contains, ends-with or field='value' predicates (repeatable; each filter is applied to the same reply)")
+	flag.BoolVar(&config.StrictFilter, "strict-filter", false, "Fail instead of warning when the -filter ancestor path does not match the reply")
+	flag.BoolVar(&config.KeepAncestors, "filter-keep-ancestors", false, "Emit -filter matches inside their full ancestor chain only, producing a document rooted like the reply")
 	flag.StringVar(&config.Key, "key", "", "ssh key file(optional)")
-	flag.IntVar(&config.Timeout, "timeout", 30, "Connection timeout in seconds")
+	flag.StringVar(&config.KeyPassphrase, "key-passphrase", "", "Passphrase for an encrypted -key")
+	flag.BoolVar(&config.UseAgent, "use-agent", os.Getenv("SSH_AUTH_SOCK") != "", "Authenticate with keys from the ssh-agent at $SSH_AUTH_SOCK (default on when it is set)")
+	flag.StringVar(&config.Ciphers, "ciphers", "", "Comma-separated SSH ciphers to offer, in order, e.g. aes128-ctr,aes128-cbc (default: crypto/ssh's)")
+	flag.StringVar(&config.KeyExchanges, "kex", "", "Comma-separated SSH key exchange algorithms to offer, e.g. diffie-hellman-group14-sha1 (default: crypto/ssh's)")
+	flag.StringVar(&config.MACs, "macs", "", "Comma-separated SSH MAC algorithms to offer, e.g. hmac-sha1 (default: crypto/ssh's)")
+	flag.StringVar(&config.HostKeyAlgos, "host-key-algos", "", "Comma-separated SSH host key algorithms to accept, e.g. ssh-rsa (default: crypto/ssh's)")
+	flag.BoolVar(&config.Legacy, "legacy", false, "Also offer the CBC ciphers, SHA-1 key exchanges and ssh-rsa/ssh-dss host keys older Cisco/Juniper devices need; -ciphers, -kex, -macs and -host-key-algos still win")
+	flag.StringVar(&config.KeyAlgorithm, "key-algorithm", "", "Comma-separated public-key signature algorithms to offer, e.g. rsa-sha2-512,rsa-sha2-256 (default: negotiated by crypto/ssh)")
+	flag.IntVar(&config.Timeout, "connect-timeout", 30, "Timeout in seconds for the TCP connect and the SSH/TLS handshake")
+	flag.IntVar(&config.Timeout, "timeout", 30, "Old name for -connect-timeout")
+	flag.IntVar(&config.RPCTimeout, "rpc-timeout", 120, "Timeout in seconds to wait for each RPC reply")
+	flag.StringVar(&config.Indent, "indent", "2", "Indentation of pretty output: a number of spaces, tab, or 0 for compact output")
+	flag.BoolVar(&config.Compact, "compact", false, "Emit single-line XML with no added whitespace (same as -indent 0)")
+	flag.StringVar(&config.Format, "format", "xml", "Convert the reply to xml (default), json or yaml")
+	flag.StringVar(&config.OutputFormat, "output-format", "pretty", "Reply output format: pretty or raw-bytes (the reply's bytes exactly as received, less the framing)")
+	flag.BoolVar(&config.Raw, "raw", false, "Print the reply exactly as received, without pretty-printing (same as -output-format raw-bytes)")
+	flag.BoolVar(&config.KeepDelimiter, "keep-delimiter", false, "Keep the ]]>]]> framing delimiter in raw-bytes output (base:1.0 sessions only)")
+	flag.StringVar(&config.HostKeyPolicy, "host-key-policy", "strict", "Host key checking: strict (reject unknown/changed), warn (print, record and proceed) or ignore")
+	flag.StringVar(&config.KnownHostsPath, "known-hosts", "", "known_hosts file used to verify host keys (default ~/.ssh/known_hosts)")
+	flag.BoolVar(&config.Insecure, "insecure", false, "Skip host key verification entirely (same as -host-key-policy ignore)")
+	flag.StringVar(&config.Template, "template", "", "Go text/template edit-config rendered once per -csv row (or per -batch-rows rows)")
+	flag.StringVar(&config.CSV, "csv", "", "CSV file with a header line providing values for -template")
+	flag.IntVar(&config.BatchRows, "batch-rows", 1, "Number of CSV rows combined into each rendered -template payload")
+	flag.StringVar(&config.TemplatesDir, "templates-dir", "", "Directory of named RPC templates (*.tmpl or *.xml, Go text/template)")
+	flag.StringVar(&config.RPCTemplate, "rpc-template", "", "Name of the template in -templates-dir to render and send")
+	flag.Var(&config.Vars, "var", "Template variable as key=value for -rpc-template (repeatable)")
+	flag.BoolVar(&config.CapabilitiesOnly, "capabilities-only", false, "Connect, print (or write to -output) the device capabilities as JSON, and exit")
+	flag.StringVar(&config.DiffCapabilities, "diff-capabilities", "", "Connect and report the capabilities and YANG modules added, removed or changed since this saved file (-capabilities-only JSON or -save-capabilities XML)")
+	flag.StringVar(&config.CapabilitiesFrom, "capabilities-from", "", "Check -require-capability against a JSON file saved with -capabilities-only instead of a live device")
+	flag.Var(&config.RequireCapabilities, "require-capability", "Abort unless the device advertises this capability: URI prefix, module name or :shorthand (repeatable)")
+	flag.StringVar(&config.EmitFixture, "emit-fixture", "", "Write the server hello, the request(s) and the raw reply(s) to this JSON file, for bug reports and replay")
+	flag.StringVar(&config.LogLevel, "log-level", "warn", "Diagnostics written to stderr: debug, info, warn or error")
+	flag.BoolVar(&config.Verbose, "verbose", false, "Shorthand for -log-level debug")
+	flag.BoolVar(&config.DebugWire, "debug-wire", false, "Dump every byte sent to and received from the device to stderr, or to -debug-wire-file")
+	flag.StringVar(&config.DebugWireFile, "debug-wire-file", "", "Write the -debug-wire dump to this file instead of stderr (implies -debug-wire)")
+	flag.IntVar(&config.Retries, "retries", 0, "Retry a connection that fails on a network error this many times (authentication failures are never retried)")
+	flag.DurationVar(&config.RetryBackoff, "retry-backoff", time.Second, "Wait before the first retry, doubled after each further attempt")
+	flag.IntVar(&config.Keepalive, "keepalive-interval", 0, "Send an SSH keepalive every this many seconds (e.g. 30) so firewalls don't drop idle sessions; 0 disables")
+	flag.StringVar(&config.Transport, "transport", "ssh", "Transport: ssh, or tls for NETCONF over TLS (RFC 7589, port 6513 unless -port is given)")
+	flag.StringVar(&config.CAFile, "ca", "", "PEM CA bundle used to verify the device certificate with -transport tls (default: system roots)")
+	flag.StringVar(&config.ClientCert, "client-cert", "", "PEM client certificate for mutual TLS with -transport tls")
+	flag.StringVar(&config.ClientKey, "client-key", "", "PEM private key for -client-cert")
+	flag.StringVar(&config.JumpHost, "jump-host", "", "Tunnel the connection through this SSH bastion, as [user@]host[:port]; user defaults to -username, port to 22")
+	flag.StringVar(&config.JumpKey, "jump-key", "", "Path to the private key for the jump host")
+	flag.StringVar(&config.JumpPassword, "jump-password", "", "Password for the jump host")
+	flag.StringVar(&config.BatchFile, "batch-file", "", "Run every RPC in this file over one session: a JSON/YAML list of payloads, or payloads separated by ]]>]]>")
+	flag.StringVar(&config.Playbook, "playbook", "", "Run the steps of this YAML playbook (lock, edit-config, validate, commit, unlock, ...) over one session and report each step's status")
+	flag.BoolVar(&config.DiffRunning, "diff-running", false, "Load the -path/-file config into the locked candidate, print how it differs from running, then discard it (or commit with -yes)")
+	flag.BoolVar(&config.Yes, "yes", false, "With -diff-running, commit the previewed change instead of discarding it")
+	flag.StringVar(&config.CheckLock, "check-lock", "", "Before sending the RPC, abort if another session holds the lock on this datastore (running or candidate), naming that session")
+	flag.DurationVar(&config.WaitForLock, "wait-for-lock", 0, "With -check-lock, keep retrying a locked datastore for up to this long (e.g. 2m) instead of aborting")
+	flag.StringVar(&config.ConfigFile, "config", "", "YAML file with default port, username, key, timeout and host key settings, plus per-host overrides under hosts:")
+	flag.StringVar(&config.Device, "device", "", "Connect to this named device from the -config inventory instead of -ip")
+	flag.StringVar(&config.Group, "group", "", "Run the RPC against every device of this -config inventory group, like -devices")
+	flag.StringVar(&config.Devices, "devices", "", "Run the RPC against every device in this inventory (one address per line, CSV with an ip column, or JSON)")
+	flag.StringVar(&config.Aggregate, "aggregate", "", "With -devices or -group, collect every device's reply (as JSON) or error into one json document written to -output, instead of -output-dir files")
+	flag.IntVar(&config.Concurrency, "concurrency", 4, "Number of devices handled in parallel with -devices or -probe-subnet")
+	flag.StringVar(&config.ProbeSubnet, "probe-subnet", "", "Exchange hellos with every address in this CIDR (e.g. 10.0.0.0/24) and report which answer, with vendor and capabilities")
+	flag.IntVar(&config.ProbeTimeout, "probe-timeout", 5, "Seconds to spend on each address with -probe-subnet")
+	flag.StringVar(&config.OutputDir, "output-dir", "results", "Directory receiving one output file per device with -devices")
+	flag.StringVar(&config.CompareWith, "compare-with", "", "Run the same RPC against this second device (same credentials) and print the differences between the replies")
+	flag.BoolVar(&config.Streams, "streams", false, "List the device's notification event streams (/netconf/streams)")
+	flag.Var(&config.GetSchema, "get-schema", "Download this YANG module, as name or name@revision, with get-schema (repeatable)")
+	flag.StringVar(&config.SchemaDir, "schema-dir", ".", "Directory receiving the <module>.yang files downloaded with -get-schema")
+	flag.StringVar(&config.Subscribe, "subscribe", "", "Subscribe to this event stream (e.g. NETCONF) and print notifications until interrupted")
+	flag.StringVar(&config.GetData, "get-data", "", "Send an NMDA <get-data> for the given datastore (running, candidate, startup, intended, operational); -file/-path, if given, is used as the subtree filter")
+	flag.StringVar(&config.OriginFilter, "origin-filter", "", "get-data origin filter identity, e.g. or:intended (operational datastore only)")
+	flag.BoolVar(&config.WithOrigin, "with-origin", false, "Request origin metadata in get-data (operational datastore only)")
+	flag.StringVar(&config.WithDefaults, "with-defaults", "", "get-data with-defaults mode: report-all, trim, explicit or report-all-tagged")
+	flag.BoolVar(&config.Unwrap, "unwrap", false, "Strip the rpc-reply/data envelope and print only its content")
+	flag.StringVar(&config.MetricsFile, "metrics-file", "", "Write Prometheus textfile metrics for this run to the given path (optional)")
+	flag.StringVar(&config.NetconfCommand, "netconf-command", "", "Exec this command instead of requesting the netconf subsystem, e.g. 'xml-mode netconf need-trailer' for legacy Junos")
+	flag.IntVar(&config.MaxHelloBytes, "max-hello-bytes", netconf.DefaultMaxHelloBytes, "Abort if the server hello exceeds this many bytes")
+	flag.StringVar(&config.SaveCapabilities, "save-capabilities", "", "Save the device capabilities to <ip>_capabilities.xml in this directory (e.g. .) after a successful run; off by default")
+	flag.BoolVar(&config.CapabilitiesOnError, "capabilities-on-error", false, "With -save-capabilities, also save them when the RPC fails")
+	flag.BoolVar(&config.RequestPty, "request-pty", false, "Allocate a pseudo-terminal before starting NETCONF (for devices that require one)")
+	flag.StringVar(&config.PtyTerm, "pty-term", "vt100", "Terminal type for -request-pty")
+	flag.IntVar(&config.PtyWidth, "pty-width", 80, "Terminal width in columns for -request-pty")
+	flag.IntVar(&config.PtyHeight, "pty-height", 24, "Terminal height in rows for -request-pty")
+	flag.BoolVar(&config.StrictHello, "strict-hello", false, "Abort unless the server hello is well-formed with a base capability and session-id")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
@@ -52,82 +288,970 @@ func main() {
 
 	flag.Parse()
 
+	// -ip may be an ssh-style user@host:port, its user and port are applied once the defaults are settled below
+	targetUser, host, targetPort := splitTarget(config.IP)
+	if strings.Contains(config.IP, "@") && targetUser == "" {
+		fmt.Printf("Error: invalid -ip %q, expected [user@]host[:port]\n", config.IP)
+		flag.Usage()
+		os.Exit(1)
+	}
+	config.IP = host
+
+	if config.Raw {
+		if explicitFlags()["output-format"] && config.OutputFormat != "raw-bytes" {
+			fmt.Printf("Error: -raw cannot be combined with -output-format %s\n", config.OutputFormat)
+			flag.Usage()
+			os.Exit(1)
+		}
+		config.OutputFormat = "raw-bytes"
+	}
+
+	level, err := parseLogLevel(config)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+	logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if config.DebugWire || config.DebugWireFile != "" {
+		wireLog = os.Stderr
+		if config.DebugWireFile != "" {
+			f, err := os.Create(config.DebugWireFile)
+			if err != nil {
+				log.Fatalf("Error: failed to create -debug-wire-file: %v", err)
+			}
+			defer f.Close()
+			wireLog = f
+		}
+	}
+
+	if config.Transport == "tls" && !explicitFlags()["port"] {
+		config.Port = netconf.DefaultTLSPort
+	}
+
+	config.explicitFlags = explicitFlags()
+	if config.ConfigFile != "" {
+		fc, err := loadConfigFile(config.ConfigFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		config.fileConfig = fc
+	}
+	if err := resolveDevice(&config); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	applySettings(&config, targetUser, targetPort)
+
+	if err := resolvePassword(&config); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
 	if err := validateConfig(config); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	output, err := runNetconfClient(config)
+	if config.CapabilitiesFrom != "" {
+		if err := checkOfflineCapabilities(config); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if config.DryRun {
+		if err := runDryRun(config); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if config.ProbeSubnet != "" {
+		results, err := runProbe(config)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		report, err := formatProbe(config, results)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if config.Output != "" {
+			writeOutput(config, report)
+		} else {
+			fmt.Print(report)
+		}
+		return
+	}
+
+	if config.Playbook != "" {
+		results, output, err := runPlaybook(config)
+		fmt.Print(formatPlaybookReport(results))
+		if output != "" {
+			writeOutput(config, output)
+		}
+		if err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+
+	if config.DiffRunning {
+		preview, err := runDiffRunning(config)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			os.Exit(exitCode(err))
+		}
+		if config.Output != "" {
+			writeOutput(config, preview)
+		} else {
+			fmt.Print(preview)
+		}
+		return
+	}
+
+	if fleetRun(config) {
+		// Ctrl-C stops starting devices and prints what completed; a second one exits right away
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		context.AfterFunc(ctx, stop)
+		results, err := runDevices(ctx, config)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Print(formatSummary(results, ctx.Err() != nil))
+		code := 0
+		for _, r := range results {
+			// a transport failure on any device outranks devices that only returned an rpc-error
+			if r.Err != nil && (code == 0 || exitCode(r.Err) == exitFailure) {
+				code = exitCode(r.Err)
+			}
+		}
+		if code != 0 {
+			os.Exit(code)
+		}
+		return
+	}
+
+	if len(config.GetSchema) > 0 {
+		if err := runGetSchema(config); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if config.Subscribe != "" {
+		if err := runSubscription(config); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	if config.CompareWith != "" {
+		diff, err := runCompare(config)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		writeOutput(config, diff)
+		return
+	}
+
+	var metrics runMetrics
+	output, err := runNetconfClient(config, &metrics)
+	if config.MetricsFile != "" {
+		metrics.Success = err == nil
+		if mErr := writeMetricsFile(config.MetricsFile, metrics, config.IP); mErr != nil {
+			fmt.Printf("Error: %v\n", mErr)
+		}
+	}
+	var stepsErr *stepsFailedError
+	if err != nil && !errors.As(err, &stepsErr) {
+		var rpcErr *netconf.RPCError
+		if errors.As(err, &rpcErr) {
+			// a readable summary on stderr, the full error reply in -output for the record
+			fmt.Fprint(os.Stderr, rpcErr.Summary())
+			if config.Output != "" && rpcErr.Raw != "" {
+				writeOutput(config, errorReplyOutput(config, rpcErr))
+			}
+		}
+		log.Printf("Error: %v", err)
+		os.Exit(exitCode(err))
+	}
+	if stepsErr != nil {
+		// the successful steps' replies are still written below
+		defer func() {
+			log.Printf("Error: %v", stepsErr)
+			os.Exit(exitCode(stepsErr))
+		}()
+	}
+	if outputIsDir(config) && multiFile(config) {
+		return
+	}
+	if streamsOutput(config) {
+		fmt.Printf("Response written to %s\n", config.Output)
+		return
+	}
+
+	output, err = postProcess(config, output)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 
-	if config.Filter != "" {
-		output = enhancedFilter(output, config.Filter)
+	output, err = convertOutput(config, output)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	writeOutput(config, output)
+}
+
+// postProcess applies -filter and -unwrap to a formatted reply, re-indenting what they return.
+func postProcess(config Config, output string) (string, error) {
+	if len(config.Filters) == 0 {
+		if !config.Unwrap {
+			return output, nil
+		}
+		return netconf.FormatXMLIndent(unwrapIfRequested(config, output), xmlIndent(config)), nil
+	}
+
+	var sections []string
+	for _, filter := range config.Filters {
+		section, err := netconf.Filter(output, filter, netconf.FilterOptions{
+			Strict:        config.StrictFilter,
+			KeepAncestors: config.KeepAncestors,
+			Logger:        logger,
+		})
+		if err != nil {
+			return "", err
+		}
+		section = unwrapIfRequested(config, section)
+		if len(config.Filters) > 1 {
+			section = fmt.Sprintf("<!-- filter: %s -->\n%s", strings.ReplaceAll(filter, "--", "- -"), section)
+		}
+		sections = append(sections, section)
+	}
+	return netconf.FormatXMLIndent(strings.Join(sections, "\n"), xmlIndent(config)), nil
+}
+
+// convertOutput renders the final XML in the -format requested.
+func convertOutput(config Config, output string) (string, error) {
+	switch config.Format {
+	case "json":
+		return netconf.ReplyToJSON(output)
+	case "yaml":
+		return netconf.ReplyToYAML(output)
+	default:
+		return output, nil
+	}
+}
+
+// parseIndent turns an -indent value into the indent string: a number of spaces, "tab", or literal whitespace.
+func parseIndent(v string) (string, error) {
+	if v == "tab" {
+		return "\t", nil
+	}
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 || n > 16 {
+			return "", fmt.Errorf("-indent must be between 0 and 16 spaces, got %d", n)
+		}
+		return strings.Repeat(" ", n), nil
+	}
+	if strings.Trim(v, " \t") == "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("unknown -indent %q; use a number of spaces, tab or 0", v)
+}
+
+// xmlIndent returns the indent string for pretty output, already checked by validateConfig.
+func xmlIndent(config Config) string {
+	if config.Compact {
+		return ""
 	}
+	indent, _ := parseIndent(config.Indent)
+	return indent
+}
 
+func writeOutput(config Config, output string) {
 	if config.Output != "" {
-		err = os.WriteFile(config.Output, []byte(output), 0644)
+		err := os.WriteFile(config.Output, []byte(output), 0644)
 		if err != nil {
 			fmt.Printf("failed to write response to file %s: %v\n", config.Output, err)
 		}
 		fmt.Printf("Response written to %s\n", config.Output)
+	} else if config.OutputFormat == "raw-bytes" {
+		os.Stdout.WriteString(output)
 	} else {
 		fmt.Println("NETCONF Response:")
 		fmt.Println(output)
 	}
 }
 
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func unwrapIfRequested(config Config, output string) string {
+	if !config.Unwrap {
+		return output
+	}
+	unwrapped, err := netconf.UnwrapReply(output)
+	if err != nil {
+		logger.Warn("output left wrapped", "error", err)
+		return output
+	}
+	return unwrapped
+}
+
+// hasTarget reports whether the run names devices to connect to: -ip (or -device), -devices, -group or -probe-subnet.
+func hasTarget(config Config) bool {
+	return config.IP != "" || fleetRun(config) || config.ProbeSubnet != ""
+}
+
+// fleetRun reports whether the RPC goes to several devices, listed by -devices or a -group.
+func fleetRun(config Config) bool {
+	return config.Devices != "" || config.Group != ""
+}
+
 func validateConfig(config Config) error {
-	if config.IP == "" || config.Password == "" {
-		return fmt.Errorf("IP address and password are required")
+	if config.CapabilitiesFrom != "" {
+		if len(config.RequireCapabilities) == 0 {
+			return fmt.Errorf("-capabilities-from requires at least one -require-capability")
+		}
+		return nil
+	}
+	if config.Transport != "ssh" && config.Transport != "tls" {
+		return fmt.Errorf("-transport must be ssh or tls")
+	}
+	if (config.ClientCert == "") != (config.ClientKey == "") {
+		return fmt.Errorf("-client-cert and -client-key must be given together")
+	}
+	if config.DryRun {
+		if fleetRun(config) || config.Subscribe != "" || len(config.GetSchema) > 0 || config.CompareWith != "" || config.CapabilitiesOnly || config.DiffCapabilities != "" {
+			return fmt.Errorf("-dry-run cannot be combined with -devices, -subscribe, -get-schema, -compare-with, -capabilities-only or -diff-capabilities")
+		}
+	} else if !hasTarget(config) {
+		return fmt.Errorf("IP address or hostname is required")
+	} else if config.Transport == "ssh" && config.Password == "" && config.Key == "" && !config.UseAgent {
+		// TLS authenticates with the client certificate, not a password
+		return fmt.Errorf("ssh credentials are required (-password, -password-env, the interactive prompt, -key or -use-agent)")
+	}
+	if port, err := strconv.Atoi(config.Port); config.Port != "" && (err != nil || port < 1 || port > 65535) {
+		return fmt.Errorf("invalid port %q, expected a number from 1 to 65535", config.Port)
+	}
+	if (config.Device != "" || config.Group != "") && config.ConfigFile == "" {
+		return fmt.Errorf("-device and -group require a -config file with an inventory")
+	}
+	if fleetRun(config) {
+		if config.Devices != "" && config.Group != "" {
+			return fmt.Errorf("cannot specify both -devices and -group; choose one")
+		}
+		if config.Aggregate != "" {
+			if config.Aggregate != "json" {
+				return fmt.Errorf("unknown -aggregate %q; use json", config.Aggregate)
+			}
+			if config.Output == "" || config.Format == "yaml" || config.OutputFormat != "pretty" {
+				return fmt.Errorf("-aggregate json requires -output and cannot be combined with -format yaml or -output-format raw-bytes")
+			}
+		} else if config.Output != "" {
+			return fmt.Errorf("-devices and -group write to -output-dir; use -aggregate json to collect the replies in -output")
+		}
+		if config.IP != "" || config.CompareWith != "" || config.MetricsFile != "" || config.EmitFixture != "" || config.CapabilitiesOnly {
+			return fmt.Errorf("-devices and -group cannot be combined with -ip, -device, -compare-with, -metrics-file, -emit-fixture or -capabilities-only")
+		}
+		if config.Concurrency < 1 {
+			return fmt.Errorf("-concurrency must be at least 1")
+		}
+	}
+	switch config.CheckLock {
+	case "", "running", "candidate", "startup":
+	default:
+		return fmt.Errorf("unknown -check-lock datastore %q; use running, candidate or startup", config.CheckLock)
+	}
+	if config.WaitForLock < 0 || (config.WaitForLock > 0 && config.CheckLock == "") {
+		return fmt.Errorf("-wait-for-lock takes a positive duration and requires -check-lock")
+	}
+	if config.Aggregate != "" && !fleetRun(config) {
+		return fmt.Errorf("-aggregate requires -devices or -group")
+	}
+	if config.Yes && !config.DiffRunning {
+		return fmt.Errorf("-yes only applies to -diff-running")
+	}
+	if config.CapabilitiesOnError && config.SaveCapabilities == "" {
+		return fmt.Errorf("-capabilities-on-error requires -save-capabilities")
+	}
+	if config.Retries < 0 || config.RetryBackoff < 0 {
+		return fmt.Errorf("-retries and -retry-backoff cannot be negative")
+	}
+	if config.Keepalive < 0 {
+		return fmt.Errorf("-keepalive-interval cannot be negative")
+	}
+	if config.JumpHost != "" {
+		if _, _, err := parseJumpHost(config.JumpHost, config.Username); err != nil {
+			return err
+		}
+		if config.JumpKey == "" && config.JumpPassword == "" {
+			return fmt.Errorf("-jump-host requires -jump-key or -jump-password")
+		}
 	}
 	if config.Path != "" && config.File != "" {
 		return fmt.Errorf("cannot specify both -path and -file; choose one")
 	}
-	if config.Path == "" && config.File == "" {
+	if config.Template != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" {
+			return fmt.Errorf("-template cannot be combined with -path, -file or -get-data")
+		}
+		if config.CSV == "" {
+			return fmt.Errorf("-template requires -csv")
+		}
+		if config.BatchRows < 1 {
+			return fmt.Errorf("-batch-rows must be at least 1")
+		}
+	} else if config.BatchFile != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" || config.Streams || config.RPCTemplate != "" || config.StreamFile || config.Playbook != "" {
+			return fmt.Errorf("-batch-file cannot be combined with -path, -file, -get-data, -streams, -rpc-template, -stream-file or -playbook")
+		}
+	} else if config.CapabilitiesOnly {
+		if config.Path != "" || config.File != "" || config.GetData != "" || config.Streams || len(config.Filters) > 0 || config.Unwrap {
+			return fmt.Errorf("-capabilities-only cannot be combined with an RPC, -filter or -unwrap")
+		}
+		if config.DiffCapabilities != "" {
+			return fmt.Errorf("-capabilities-only and -diff-capabilities are separate modes; choose one")
+		}
+	} else if config.DiffCapabilities != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" || config.Streams || len(config.Filters) > 0 || config.Unwrap || fleetRun(config) || config.CompareWith != "" {
+			return fmt.Errorf("-diff-capabilities cannot be combined with an RPC, -filter, -unwrap, -devices or -compare-with")
+		}
+	} else if config.RPCTemplate != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" || config.Streams {
+			return fmt.Errorf("-rpc-template cannot be combined with -path, -file, -get-data or -streams")
+		}
+		if config.TemplatesDir == "" {
+			return fmt.Errorf("-rpc-template requires -templates-dir")
+		}
+	} else if config.Streams {
+		if config.Path != "" || config.File != "" || config.GetData != "" {
+			return fmt.Errorf("-streams cannot be combined with -path, -file or -get-data")
+		}
+	} else if len(config.GetSchema) > 0 {
+		if config.Path != "" || config.File != "" || config.GetData != "" || fleetRun(config) || config.Subscribe != "" || config.CompareWith != "" {
+			return fmt.Errorf("-get-schema cannot be combined with -path, -file, -get-data, -devices, -subscribe or -compare-with")
+		}
+	} else if config.Subscribe != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" || fleetRun(config) || config.CompareWith != "" {
+			return fmt.Errorf("-subscribe cannot be combined with -path, -file, -get-data, -devices or -compare-with")
+		}
+	} else if config.ProbeSubnet != "" {
+		if config.IP != "" || fleetRun(config) || config.Path != "" || config.File != "" || config.GetData != "" || config.Playbook != "" || config.CompareWith != "" {
+			return fmt.Errorf("-probe-subnet cannot be combined with -ip, -devices, -path, -file, -get-data, -playbook or -compare-with")
+		}
+		if config.Concurrency < 1 || config.ProbeTimeout < 1 {
+			return fmt.Errorf("-concurrency and -probe-timeout must be at least 1")
+		}
+	} else if config.DiffRunning {
+		if config.Path == "" && config.File == "" {
+			return fmt.Errorf("-diff-running requires the config to apply in -path or -file")
+		}
+		if config.GetData != "" || fleetRun(config) || config.CompareWith != "" || config.Playbook != "" || config.DryRun || config.StreamFile || multiFile(config) {
+			return fmt.Errorf("-diff-running takes a single -path or -file and cannot be combined with -get-data, -devices, -compare-with, -playbook, -dry-run or -stream-file")
+		}
+	} else if config.Playbook != "" {
+		if config.Path != "" || config.File != "" || config.GetData != "" || fleetRun(config) || config.CompareWith != "" || config.DryRun {
+			return fmt.Errorf("-playbook cannot be combined with -path, -file, -get-data, -devices, -compare-with or -dry-run")
+		}
+	} else if config.Path == "" && config.File == "" && config.GetData == "" {
 		return fmt.Errorf("either -path or -file must be specified")
 	}
+	for _, algo := range splitList(config.KeyAlgorithm) {
+		if !slices.Contains(keySignatureAlgorithms, algo) {
+			return fmt.Errorf("unknown -key-algorithm %q; use one of %s", algo, strings.Join(keySignatureAlgorithms, ", "))
+		}
+	}
+	for _, set := range []struct {
+		flag, value string
+		supported   []string
+	}{
+		{"-ciphers", config.Ciphers, netconf.SupportedCiphers},
+		{"-kex", config.KeyExchanges, netconf.SupportedKeyExchanges},
+		{"-macs", config.MACs, netconf.SupportedMACs},
+		{"-host-key-algos", config.HostKeyAlgos, netconf.SupportedHostKeys},
+	} {
+		for _, algo := range splitList(set.value) {
+			if !slices.Contains(set.supported, algo) {
+				return fmt.Errorf("unknown %s %q; use one of %s", set.flag, algo, strings.Join(set.supported, ", "))
+			}
+		}
+	}
+	if config.CompareWith != "" && (config.Template != "" || config.CapabilitiesOnly || config.OutputFormat != "pretty") {
+		return fmt.Errorf("-compare-with cannot be combined with -template, -capabilities-only or -output-format raw-bytes")
+	}
+	if (config.StreamFile || config.GetData != "") && multiFile(config) {
+		return fmt.Errorf("-stream-file and -get-data take a single -file")
+	}
+	if config.StreamFile && (config.File == "" || config.GetData != "" || config.EmitFixture != "") {
+		return fmt.Errorf("-stream-file requires -file and cannot be combined with -get-data or -emit-fixture")
+	}
+	if config.Timeout <= 0 {
+		return fmt.Errorf("-connect-timeout must be a positive number of seconds, got %d", config.Timeout)
+	}
+	if config.RPCTimeout <= 0 {
+		return fmt.Errorf("-rpc-timeout must be a positive number of seconds, got %d", config.RPCTimeout)
+	}
+	switch config.FileEncoding {
+	case "", "base64", "hex":
+	default:
+		return fmt.Errorf("unknown -file-encoding %q; use base64 or hex", config.FileEncoding)
+	}
+	switch config.HostKeyPolicy {
+	case "strict", "warn", "ignore":
+	default:
+		return fmt.Errorf("unknown -host-key-policy %q; use strict, warn or ignore", config.HostKeyPolicy)
+	}
+	if config.Insecure && config.HostKeyPolicy == "warn" {
+		return fmt.Errorf("-insecure cannot be combined with -host-key-policy warn")
+	}
+	if _, err := parseIndent(config.Indent); err != nil {
+		return err
+	}
+	switch config.Format {
+	case "xml":
+	case "json", "yaml":
+		if config.OutputFormat == "raw-bytes" || config.CapabilitiesOnly || config.DiffCapabilities != "" || config.CompareWith != "" {
+			return fmt.Errorf("-format %s cannot be combined with -output-format raw-bytes, -capabilities-only, -diff-capabilities or -compare-with", config.Format)
+		}
+	default:
+		return fmt.Errorf("unknown -format %q; use xml, json or yaml", config.Format)
+	}
+	switch config.OutputFormat {
+	case "pretty":
+	case "raw-bytes":
+		if len(config.Filters) > 0 || config.Unwrap {
+			return fmt.Errorf("-filter and -unwrap cannot be used with -raw or -output-format raw-bytes; they need the parsed reply")
+		}
+	default:
+		return fmt.Errorf("unknown -output-format %q; use pretty or raw-bytes", config.OutputFormat)
+	}
 	return nil
 }
 
-func runNetconfClient(config Config) (string, error) {
+var keySignatureAlgorithms = []string{
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA,
+	ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+}
+
+// sshAlgorithms combines -legacy with -ciphers, -kex, -macs and -host-key-algos, the explicit lists winning.
+func sshAlgorithms(config Config) netconf.SSHAlgorithms {
+	var algorithms netconf.SSHAlgorithms
+	if config.Legacy {
+		algorithms = netconf.LegacyAlgorithms
+	}
+	for _, set := range []struct {
+		value string
+		list  *[]string
+	}{
+		{config.Ciphers, &algorithms.Ciphers},
+		{config.KeyExchanges, &algorithms.KeyExchanges},
+		{config.MACs, &algorithms.MACs},
+		{config.HostKeyAlgos, &algorithms.HostKeys},
+	} {
+		if names := splitList(set.value); len(names) > 0 {
+			*set.list = names
+		}
+	}
+	return algorithms
+}
+
+// newEndpoint translates the CLI flags into an Endpoint.
+func newEndpoint(config Config) *netconf.Endpoint {
+	opts := []netconf.Option{
+		netconf.WithPort(config.Port),
+		netconf.WithPassword(config.Username, config.Password),
+		netconf.WithTimeout(config.Timeout),
+		netconf.WithRPCTimeout(config.RPCTimeout),
+		netconf.WithHostKeyPolicy(hostKeyPolicy(config), config.KnownHostsPath),
+		netconf.WithMaxHelloBytes(config.MaxHelloBytes),
+		netconf.WithNetconfCommand(config.NetconfCommand),
+	}
+	if config.Key != "" {
+		opts = append(opts, netconf.WithPrivateKey(config.Key, config.KeyPassphrase))
+	}
+	if algorithms := splitList(config.KeyAlgorithm); len(algorithms) > 0 {
+		opts = append(opts, netconf.WithKeyAlgorithms(algorithms...))
+	}
+	opts = append(opts, netconf.WithSSHAlgorithms(sshAlgorithms(config)))
+	if config.UseAgent {
+		opts = append(opts, netconf.WithAgent())
+	}
+	if config.StrictHello {
+		opts = append(opts, netconf.WithStrictHello())
+	}
+	if config.RequestPty {
+		opts = append(opts, netconf.WithPty(config.PtyTerm, config.PtyWidth, config.PtyHeight))
+	}
+	if config.Keepalive > 0 {
+		opts = append(opts, netconf.WithKeepalive(config.Keepalive))
+	}
+	opts = append(opts, netconf.WithLogger(logger))
+	if wireLog != nil {
+		opts = append(opts, netconf.WithWireLog(wireLog))
+	}
+	if config.JumpHost != "" {
+		// already checked by validateConfig
+		user, addr, _ := parseJumpHost(config.JumpHost, config.Username)
+		opts = append(opts, netconf.WithJumpHost(addr, user, config.JumpPassword, config.JumpKey))
+	}
+	if config.Transport == "tls" {
+		// WithTLS sets the TLS default port, so it has to come before WithPort
+		opts = append([]netconf.Option{netconf.WithTLS(config.CAFile, config.ClientCert, config.ClientKey)}, opts...)
+	}
+	return netconf.NewEndpoint(config.IP, opts...)
+}
+
+// splitTarget splits an ssh-style [user@]host[:port] target; user and port are empty when not given.
+func splitTarget(spec string) (user, host, port string) {
+	hostPort := spec
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		user, hostPort = spec[:i], spec[i+1:]
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		// no port given, or a bare IPv6 address
+		host, port = strings.TrimSuffix(strings.TrimPrefix(hostPort, "["), "]"), ""
+	}
+	return user, host, port
+}
+
+// applySettings layers the connection settings. From strongest to weakest: explicit flags, the -ip
+// user@host:port shorthand, the -config entry for the host or device, and the defaults.
+func applySettings(config *Config, targetUser, targetPort string) {
+	applyConfigFile(config, config.IP, config.Device)
+	// after the -config entry, so the shorthand overrides it
+	applyTarget(config, targetUser, targetPort)
+}
+
+// applyTarget uses the user and port from an -ip user@host:port shorthand, unless -username or -port was given.
+func applyTarget(config *Config, user, port string) {
+	explicit := config.explicitFlags
+	if user != "" && !explicit["username"] {
+		config.Username = user
+	}
+	if port != "" && !explicit["port"] {
+		config.Port = port
+	}
+}
+
+// parseJumpHost splits a [user@]host[:port] jump host spec, defaulting to defaultUser and port 22.
+func parseJumpHost(spec, defaultUser string) (user, addr string, err error) {
+	user, host, port := splitTarget(spec)
+	if !strings.Contains(spec, "@") {
+		user = defaultUser
+	}
+	if port == "" {
+		port = "22"
+	}
+	if user == "" || host == "" {
+		return "", "", fmt.Errorf("invalid -jump-host %q, expected [user@]host[:port]", spec)
+	}
+	return user, net.JoinHostPort(host, port), nil
+}
+
+// parseLogLevel returns the -log-level threshold, debug when -verbose is set.
+func parseLogLevel(config Config) (slog.Level, error) {
+	if config.Verbose {
+		return slog.LevelDebug, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+		return 0, fmt.Errorf("unknown -log-level %q; use debug, info, warn or error", config.LogLevel)
+	}
+	return level, nil
+}
+
+// hostKeyPolicy maps -insecure onto the ignore policy so Endpoint only deals with one setting.
+func hostKeyPolicy(config Config) string {
+	if config.Insecure {
+		return "ignore"
+	}
+	return config.HostKeyPolicy
+}
 
-	ncEndPoint := Endpoint{
-		Ip:          config.IP,
-		Username:    config.Username,
-		Password:    config.Password,
-		PrivKeyPath: config.Key,
-		Timeout:     10,
-		Port:        config.Port,
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
+	return out
+}
+
+func runNetconfClient(config Config, metrics *runMetrics) (output string, err error) {
+
+	ncEndPoint := newEndpoint(config)
 
-	if err := ncEndPoint.Connect(); err != nil {
-		log.Fatalln(err)
+	start := time.Now()
+	if err := ncEndPoint.ConnectWithRetry(context.Background(), config.Retries+1, config.RetryBackoff); err != nil {
+		return "", err
 	}
+	metrics.ConnectDuration = time.Since(start)
 	defer ncEndPoint.Disconnect()
 
-	err := os.WriteFile(config.IP+"_capabilities.xml", []byte(formatXML(ncEndPoint.Capabilities)), 0644)
+	// Capabilities are only saved once the run is known to have succeeded, so a failed RPC
+	// doesn't leave a partial artifact behind, and a failed save never aborts the RPC itself.
+	defer func() {
+		if config.SaveCapabilities != "" && (err == nil || config.CapabilitiesOnError) {
+			saveCapabilities(filepath.Join(config.SaveCapabilities, config.IP+"_capabilities.xml"), ncEndPoint.Capabilities)
+		}
+	}()
+
+	if config.GetData != "" && !ncEndPoint.HasCapability(netconf.NMDACapability) {
+		return "", fmt.Errorf("device does not advertise the %s capability required for get-data", netconf.NMDACapability)
+	}
+
+	if missing := netconf.MissingCapabilities(ncEndPoint.ParsedCapabilities, config.RequireCapabilities); len(missing) > 0 {
+		return "", fmt.Errorf("device does not advertise required capabilities: %s", strings.Join(missing, ", "))
+	}
+
+	if config.OutputFormat == "raw-bytes" && config.KeepDelimiter && ncEndPoint.BaseVersion() == "1.1" {
+		// chunked replies are de-framed by the time gonc sees them, there is no delimiter to put back
+		return "", fmt.Errorf("-keep-delimiter only applies to base:1.0 framing; the device negotiated base:1.1 chunked framing")
+	}
+
+	if config.CapabilitiesOnly {
+		snapshot, err := newCapabilitySnapshot(config.IP, ncEndPoint.Capabilities)
+		if err != nil {
+			return "", err
+		}
+		snapshot.BaseVersion = ncEndPoint.BaseVersion()
+		data, err := json.MarshalIndent(snapshot, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	if config.DiffCapabilities != "" {
+		saved, err := loadSavedCapabilities(config.DiffCapabilities)
+		if err != nil {
+			return "", err
+		}
+		return formatCapabilityDiff(netconf.DiffCapabilities(saved, ncEndPoint.ParsedCapabilities)), nil
+	}
+
+	if config.Streams {
+		if err := netconf.RequireNotifications(ncEndPoint); err != nil {
+			return "", err
+		}
+	}
+
+	if config.CheckLock != "" {
+		if err := checkLock(ncEndPoint, config.CheckLock, config.WaitForLock); err != nil {
+			return "", err
+		}
+	}
+
+	if config.StreamFile {
+		start = time.Now()
+		reply, err := streamRPCFile(ncEndPoint, config)
+		if err != nil {
+			return "", fmt.Errorf("failed to execute NETCONF RPC: %w", err)
+		}
+		metrics.RPCDuration = time.Since(start)
+		metrics.ReplyBytes = len(reply)
+		return processReply(config, reply, ncEndPoint.FramingVersion)
+	}
+
+	rpcs, labels, err := buildRPCs(config)
+	if err != nil {
+		return "", err
+	}
+
+	var fx *fixture
+	if config.EmitFixture != "" {
+		fx = &fixture{Host: config.IP, Hello: ncEndPoint.Capabilities, BaseVersion: ncEndPoint.BaseVersion()}
+		defer func() {
+			if fErr := writeFixture(config.EmitFixture, fx); fErr != nil {
+				logger.Warn(fErr.Error())
+			}
+		}()
+	}
+
+	if streamsOutput(config) {
+		start = time.Now()
+		n, err := streamReplyToOutput(ncEndPoint, config, rpcs[0])
+		if err != nil {
+			return "", fmt.Errorf("failed to execute NETCONF RPC: %w", err)
+		}
+		metrics.RPCDuration = time.Since(start)
+		metrics.ReplyBytes = int(n)
+		return "", nil
+	}
+
+	perFileOutput := labels != nil && outputIsDir(config)
+	if perFileOutput {
+		if err := os.MkdirAll(config.Output, 0755); err != nil {
+			return "", fmt.Errorf("failed to create output directory %s: %v", config.Output, err)
+		}
+	}
+
+	var responses, failed []string
+	var rpcErrors int
+	for i, rpc := range rpcs {
+		step := fmt.Sprintf("RPC %d of %d", i+1, len(rpcs))
+		if labels != nil {
+			step = fmt.Sprintf("step %d of %d (%s)", i+1, len(rpcs), labels[i])
+		}
+		warnIfOversized(ncEndPoint, int64(len(rpc)))
+
+		start = time.Now()
+		reply, err := ncEndPoint.Run(rpc)
+		if fx != nil {
+			fx.Exchanges = append(fx.Exchanges, fixtureExchange{Request: rpc, Reply: reply})
+		}
+		if err == nil {
+			metrics.RPCDuration += time.Since(start)
+			metrics.ReplyBytes += len(reply)
+			var response string
+			response, err = processReply(config, reply, ncEndPoint.FramingVersion)
+			if err != nil && len(rpcs) == 1 {
+				return "", err
+			}
+			if err == nil {
+				if perFileOutput {
+					err = writeStepOutput(config, labels[i], response)
+				} else {
+					responses = append(responses, response)
+				}
+			}
+		}
+		if err != nil {
+			if len(rpcs) == 1 {
+				return "", fmt.Errorf("failed to execute NETCONF RPC: %w", err)
+			}
+			if !config.ContinueOnErr {
+				return "", fmt.Errorf("failed to execute NETCONF %s: %w", step, err)
+			}
+			logger.Error("step failed, continuing", "step", step, "error", err)
+			failed = append(failed, fmt.Sprintf("%s: %v", step, err))
+			if exitCode(err) == exitRPCError {
+				rpcErrors++
+			}
+		}
+	}
+
+	output = strings.Join(responses, "\n")
+	if len(failed) > 0 {
+		return output, &stepsFailedError{Failed: failed, Total: len(rpcs), RPCErrors: rpcErrors}
+	}
+	return output, nil
+}
+
+// streamsOutput reports whether the reply can go straight to the -output file as it arrives, which is only
+// the case for a single RPC in raw-bytes format with nothing to filter, unwrap or convert afterwards.
+func streamsOutput(config Config) bool {
+	return config.Output != "" && config.OutputFormat == "raw-bytes" && !config.KeepDelimiter &&
+		len(config.Filters) == 0 && !config.Unwrap && config.Format == "xml" &&
+		config.Template == "" && config.BatchFile == "" && !multiFile(config) && config.EmitFixture == "" && !config.StreamFile &&
+		!config.CapabilitiesOnly && config.DiffCapabilities == "" && config.CompareWith == "" && !fleetRun(config)
+}
+
+// streamReplyToOutput copies the reply to rpc into the -output file with RunStream and returns its size.
+func streamReplyToOutput(ncEndPoint *netconf.Endpoint, config Config, rpc string) (int64, error) {
+	f, err := os.Create(config.Output)
 	if err != nil {
-		return "", fmt.Errorf("failed to write response to file %s: %v", config.Output, err)
+		return 0, fmt.Errorf("failed to create output file %s: %v", config.Output, err)
+	}
+	w := &countingWriter{w: f}
+	err = ncEndPoint.RunStream(rpc, w)
+	if cErr := f.Close(); err == nil && cErr != nil {
+		err = fmt.Errorf("failed to write output file %s: %v", config.Output, cErr)
 	}
+	return w.n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
 
-	formattedResponse := ""
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
 
-	rpc, err := getRPCPayload(config)
+// buildRPCs assembles the RPCs to send from the payload flags, wrapping bare operations unless -no-wrap is set.
+// labels names the input file of each RPC when -file lists several, and is nil otherwise.
+func buildRPCs(config Config) (rpcs, labels []string, err error) {
+	if config.Template != "" {
+		rpcs, err = templatePayloads(config)
+	} else if config.BatchFile != "" {
+		rpcs, err = loadBatchFile(config.BatchFile)
+	} else if config.Streams {
+		rpcs = []string{netconf.StreamsRPC}
+	} else if config.RPCTemplate != "" {
+		var rpc string
+		rpc, err = rpcTemplatePayload(config)
+		rpcs = []string{rpc}
+	} else if multiFile(config) {
+		rpcs, labels, err = filePayloads(config)
+	} else {
+		var rpc string
+		rpc, err = getRPCPayload(config)
+		rpcs = []string{rpc}
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get RPC payload: %v", err)
+		return nil, nil, fmt.Errorf("failed to get RPC payload: %v", err)
+	}
+	if !config.NoWrap {
+		for i, rpc := range rpcs {
+			if rpcs[i], err = netconf.WrapRPC(rpc); err != nil {
+				return nil, nil, fmt.Errorf("failed to get RPC payload: %v", err)
+			}
+		}
+	}
+	return rpcs, labels, nil
+}
+
+func saveCapabilities(path, capabilities string) {
+	if err := os.WriteFile(path, []byte(netconf.FormatXML(capabilities)), 0644); err != nil {
+		logger.Warn("failed to write capabilities", "file", path, "error", err)
+	}
+}
+
+// processReply applies the configured output format to a single raw reply, read with the given framing.
+func processReply(config Config, reply, framing string) (string, error) {
+	if config.OutputFormat == "raw-bytes" {
+		// Run returns the reply without its delimiter, put back what was on the wire
+		if config.KeepDelimiter && framing != "1.1" {
+			reply += "]]>]]>"
+		}
+		return reply, nil
 	}
 
-	reply, err := ncEndPoint.Run(rpc)
+	reply, err := netconf.ToUTF8(reply)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute NETCONF RPC: %v", err)
+		return "", err
 	}
 
-	formattedResponse = formatXML(reply)
+	return netconf.FormatXMLIndent(reply, xmlIndent(config)), nil
+}
 
-	return formattedResponse, nil
+// errorReplyOutput renders the reply carrying an rpc-error for -output: unchanged in raw-bytes mode, pretty-printed otherwise.
+func errorReplyOutput(config Config, rpcErr *netconf.RPCError) string {
+	if config.OutputFormat == "raw-bytes" {
+		return rpcErr.Raw
+	}
+	return netconf.FormatXMLIndent(rpcErr.Raw, xmlIndent(config))
 }
 
 func removeEmptyLines(s string) string {
@@ -149,47 +1273,154 @@ func removeEmptyLines(s string) string {
 }
 
 func getRPCPayload(config Config) (string, error) {
+	payload := config.Path
 	if config.File != "" {
-		data, err := os.ReadFile(config.File)
+		var err error
+		if payload, err = readRPCFile(config, config.File); err != nil {
+			return "", err
+		}
+	}
+
+	if config.GetData != "" {
+		return netconf.BuildGetDataRPC(netconf.GetDataOptions{
+			Datastore:     config.GetData,
+			SubtreeFilter: strings.TrimSuffix(strings.TrimSpace(payload), "]]>]]>"),
+			OriginFilter:  config.OriginFilter,
+			WithOrigin:    config.WithOrigin,
+			WithDefaults:  config.WithDefaults,
+		})
+	}
+	return payload, nil
+}
+
+// readRPCFile reads one RPC payload file, decoding -file-encoding.
+func readRPCFile(config Config, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read XML file %s: %v", path, err)
+	}
+	data, err = decodePayload(data, config.FileEncoding)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return removeEmptyLines(string(data)), nil
+}
+
+// filePayloads reads every file named by a multi-file -file, returning the payloads and the file names.
+func filePayloads(config Config) ([]string, []string, error) {
+	files, err := rpcFiles(config.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rpcs []string
+	for _, file := range files {
+		rpc, err := readRPCFile(config, file)
 		if err != nil {
-			return "", fmt.Errorf("failed to read XML file %s: %v", config.File, err)
+			return nil, nil, err
 		}
-		return removeEmptyLines(string(data)), nil
+		rpcs = append(rpcs, rpc)
 	}
-	return config.Path, nil
+	return rpcs, files, nil
 }
 
-func formatXML(data string) string {
-	var b strings.Builder
-	b.Grow(len(data))
-
-	indent := 0
-	for i := range len(data) {
-		switch data[i] {
-		case '<':
-			if i+1 < len(data) && data[i+1] == '/' {
-				indent--
-				b.WriteByte('<')
-			} else {
-				b.WriteByte('<')
-				indent++
-			}
-		case '>':
-			b.WriteByte('>')
-		default:
-			b.WriteByte(data[i])
+// writeStepOutput post-processes one step's reply and writes it next to the others in the -output directory.
+func writeStepOutput(config Config, input, response string) error {
+	response, err := postProcess(config, response)
+	if err != nil {
+		return err
+	}
+	if response, err = convertOutput(config, response); err != nil {
+		return err
+	}
+	path := filepath.Join(config.Output, replyFileName(input, config.Format))
+	if err := os.WriteFile(path, []byte(response), 0644); err != nil {
+		return fmt.Errorf("failed to write response to file %s: %v", path, err)
+	}
+	fmt.Printf("Response to %s written to %s\n", input, path)
+	return nil
+}
+
+// streamRPCFile sends -file through Endpoint.RunReader, decoding -file-encoding on the fly and wrapping a bare
+// operation in an <rpc> envelope unless -no-wrap is set.
+func streamRPCFile(ncEndPoint *netconf.Endpoint, config Config) (string, error) {
+	f, err := os.Open(config.File)
+	if err != nil {
+		return "", fmt.Errorf("failed to open XML file %s: %v", config.File, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch config.FileEncoding {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, newWhitespaceStripper(f))
+	case "hex":
+		r = hex.NewDecoder(newWhitespaceStripper(f))
+	default:
+		if info, err := f.Stat(); err == nil {
+			warnIfOversized(ncEndPoint, info.Size())
+		}
+	}
+	if !config.NoWrap {
+		if r, err = netconf.WrapRPCReader(r); err != nil {
+			return "", err
 		}
 	}
+	return ncEndPoint.RunReader(r)
+}
 
-	lines := strings.Split(b.String(), "\n")
-	var result []string
-	for _, line := range lines {
-		if strings.TrimSpace(line) != "" {
-			result = append(result, line)
+// warnIfOversized warns when a payload of size bytes exceeds the max message size the device advertises.
+func warnIfOversized(ncEndPoint *netconf.Endpoint, size int64) {
+	if limit := ncEndPoint.MaxMessageSize(); limit > 0 && size > int64(limit) {
+		logger.Warn("RPC payload exceeds the device's advertised max message size", "bytes", size, "max-message-size", limit)
+	}
+}
+
+// whitespaceStripper drops ASCII whitespace so line-wrapped base64/hex files decode as a stream.
+type whitespaceStripper struct {
+	r io.Reader
+}
+
+func newWhitespaceStripper(r io.Reader) io.Reader {
+	return &whitespaceStripper{r: r}
+}
+
+func (w *whitespaceStripper) Read(p []byte) (int, error) {
+	for {
+		n, err := w.r.Read(p)
+		kept := 0
+		for _, c := range p[:n] {
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				p[kept] = c
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
 		}
 	}
+}
 
-	return strings.Join(result, "\n")
+// decodePayload decodes a base64 or hex encoded payload; "" leaves it untouched.
+func decodePayload(data []byte, encoding string) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(data)), "")
+	switch encoding {
+	case "":
+		return data, nil
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %v", err)
+		}
+		return decoded, nil
+	case "hex":
+		decoded, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex payload: %v", err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("unknown encoding %q; use base64 or hex", encoding)
+	}
 }
 
 func removePaths(stack []byte) []byte {
@@ -219,129 +1450,3 @@ func customPanicHandler() {
 		os.Exit(1)
 	}
 }
-
-func parseXPathFilter(filter string) (predicate []string, path []string, err error) {
-
-	filter = strings.Trim(filter, "/ ")
-	startIdx := strings.Index(filter, "[")
-	if startIdx == -1 {
-		return nil, nil, fmt.Errorf("no predicate found in filter")
-	}
-
-	pathStr := filter[:startIdx]
-	predicateStr := filter[startIdx:]
-	path = strings.Split(pathStr, "/")
-	if len(path) == 0 {
-		return nil, nil, fmt.Errorf("empty path")
-	}
-
-	predicateStr = strings.Trim(predicateStr, "[]")
-	if strings.HasPrefix(predicateStr, "start-with(") {
-		argsStr := strings.TrimPrefix(predicateStr, "start-with(")
-		argsStr = strings.TrimSuffix(argsStr, ")")
-		predicate = strings.SplitN(argsStr, ",", 2)
-		if len(predicate) != 2 {
-			return nil, nil, fmt.Errorf("invalid start-with predicate: %s", predicateStr)
-		}
-		predicate[1] = strings.Trim(predicate[1], "'\"")
-	} else {
-		predicate = []string{predicateStr}
-	}
-
-	return predicate, path, nil
-}
-
-func enhancedFilter(xmlData, filter string) string {
-
-	// filter := "/rpc-reply/data/terminal-device/logical-channels/channel[start-with(index,'10115')]"
-
-	predicate, path, err := parseXPathFilter(filter)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		return ""
-	}
-	targetElement := path[len(path)-1]
-	predicatePrefix := predicate[1]
-	var output bytes.Buffer
-	var currentChannel bytes.Buffer
-	inChannel := false
-	keepChannel := false
-	depth := 0
-	stack := []xml.StartElement{}
-
-	decoder := xml.NewDecoder(strings.NewReader(xmlData))
-
-	for {
-		token, err := decoder.Token()
-		if err != nil {
-			break
-		}
-
-		switch t := token.(type) {
-		case xml.StartElement:
-			if t.Name.Local == targetElement && !inChannel {
-				inChannel = true
-				depth = 1
-				currentChannel.Reset()
-				currentChannel.WriteString(xmlMarshalStartElement(t))
-			} else if inChannel {
-				depth++
-				currentChannel.WriteString(xmlMarshalStartElement(t))
-				if t.Name.Local == "index" {
-					nextToken, _ := decoder.Token()
-					if charData, ok := nextToken.(xml.CharData); ok {
-						indexValue := string(charData)
-						if strings.HasPrefix(indexValue, predicatePrefix) {
-							keepChannel = true
-						}
-						currentChannel.WriteString(indexValue)
-					}
-				}
-			} else {
-				output.WriteString(xmlMarshalStartElement(t))
-				stack = append(stack, t)
-			}
-
-		case xml.EndElement:
-			if inChannel {
-				currentChannel.WriteString(fmt.Sprintf("</%s>", t.Name.Local))
-				depth--
-				if depth == 0 {
-					inChannel = false
-					if keepChannel {
-						output.Write(currentChannel.Bytes())
-						output.WriteString("\n")
-					}
-					keepChannel = false
-				}
-			} else {
-				if len(stack) > 0 {
-					output.WriteString(fmt.Sprintf("</%s>\n", t.Name.Local))
-					stack = stack[:len(stack)-1]
-				}
-			}
-
-		case xml.CharData:
-			if inChannel {
-				currentChannel.WriteString(string(t))
-			} else {
-				output.WriteString(string(t))
-			}
-		}
-	}
-
-	for i := len(stack) - 1; i >= 0; i-- {
-		output.WriteString(fmt.Sprintf("</%s>\n", stack[i].Name.Local))
-	}
-
-	return formatXML(output.String())
-
-}
-
-func xmlMarshalStartElement(se xml.StartElement) string {
-	var attrs string
-	for _, attr := range se.Attr {
-		attrs += fmt.Sprintf(` %s="%s"`, attr.Name.Local, attr.Value)
-	}
-	return fmt.Sprintf("<%s%s>", se.Name.Local, attrs)
-}
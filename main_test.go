@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/naseriax/gonc/netconf"
+	"github.com/naseriax/gonc/netconf/netconftest"
+	"golang.org/x/crypto/ssh"
+)
+
+// validConfig is a minimal Config that passes validateConfig, for tests to vary one setting at a time.
+func validConfig(modify func(*Config)) Config {
+	config := Config{IP: "192.0.2.1", File: "get.xml", Transport: "ssh", Password: "secret", Timeout: 30, RPCTimeout: 120,
+		HostKeyPolicy: "strict", Format: "xml", OutputFormat: "pretty"}
+	modify(&config)
+	return config
+}
+
+func TestValidateConfigCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{"password", validConfig(func(c *Config) {}), ""},
+		{"key only", validConfig(func(c *Config) { c.Password, c.Key = "", "/home/u/.ssh/id_ed25519" }), ""},
+		{"agent only", validConfig(func(c *Config) { c.Password, c.UseAgent = "", true }), ""},
+		{"tls without password", validConfig(func(c *Config) { c.Password, c.Transport = "", "tls" }), ""},
+		{"no credentials", validConfig(func(c *Config) { c.Password = "" }), "ssh credentials are required"},
+		{"no target", validConfig(func(c *Config) { c.IP = "" }), "IP address or hostname is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateConfig(tt.config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateConfig: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateConfig error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNeedsPassword(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   bool
+	}{
+		{"no credentials", Config{IP: "192.0.2.1", Transport: "ssh"}, true},
+		{"fleet without credentials", Config{Devices: "devices.csv", Transport: "ssh"}, true},
+		{"password given", Config{IP: "192.0.2.1", Transport: "ssh", Password: "secret"}, false},
+		{"key given", Config{IP: "192.0.2.1", Transport: "ssh", Key: "id_ed25519"}, false},
+		{"agent by default", Config{IP: "192.0.2.1", Transport: "ssh", UseAgent: true}, true},
+		{"agent requested", Config{IP: "192.0.2.1", Transport: "ssh", UseAgent: true, explicitFlags: map[string]bool{"use-agent": true}}, false},
+		{"agent turned off", Config{IP: "192.0.2.1", Transport: "ssh", explicitFlags: map[string]bool{"use-agent": true}}, true},
+		{"tls", Config{IP: "192.0.2.1", Transport: "tls"}, false},
+		{"dry run", Config{IP: "192.0.2.1", Transport: "ssh", DryRun: true}, false},
+		{"no target", Config{Transport: "ssh"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsPassword(tt.config); got != tt.want {
+				t.Errorf("needsPassword = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// connectFakeDevice returns an Endpoint connected to d, disconnected when the test ends.
+func connectFakeDevice(t *testing.T, d *netconftest.Device) *netconf.Endpoint {
+	t.Helper()
+	s := netconf.NewEndpoint("192.0.2.1", netconf.WithDialer(d.Dial), netconf.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(s.Disconnect)
+	return s
+}
+
+// listenFakeDevice serves d over TLS on a loopback port until the test ends and returns the port.
+func listenFakeDevice(t *testing.T, d *netconftest.Device) string {
+	t.Helper()
+	ln, port, err := d.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return port
+}
+
+// captureLog sends the CLI's logger to a buffer for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := logger
+	logger = slog.New(slog.NewTextHandler(&buf, nil))
+	t.Cleanup(func() { logger = previous })
+	return &buf
+}
+
+func TestWarnIfOversized(t *testing.T) {
+	tests := []struct {
+		name     string
+		caps     []string
+		size     int64
+		wantWarn bool
+	}{
+		{"over the advertised limit", []string{"urn:vendor:limits?max-message-size=1024"}, 2048, true},
+		{"within the limit", []string{"urn:vendor:limits?max-message-size=1024"}, 512, false},
+		{"no limit advertised", nil, 1 << 30, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := connectFakeDevice(t, netconftest.NewDevice(append([]string{netconftest.Base10}, tt.caps...)...))
+			log := captureLog(t)
+			warnIfOversized(s, tt.size)
+			if got := strings.Contains(log.String(), "exceeds the device's advertised max message size"); got != tt.wantWarn {
+				t.Errorf("warned = %v, want %v (log: %q)", got, tt.wantWarn, log.String())
+			}
+		})
+	}
+}
+
+func TestFilterWarningFollowsLogLevel(t *testing.T) {
+	const reply = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>` +
+		`<interfaces><interface><name>eth0</name></interface></interfaces></data></rpc-reply>`
+	for level, wantWarn := range map[string]bool{"debug": true, "warn": true, "error": false} {
+		config := validConfig(func(c *Config) {
+			c.LogLevel = level
+			c.Filters = []string{"/wrong/interface[name='eth0']"}
+		})
+		threshold, err := parseLogLevel(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		previous := logger
+		logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: threshold}))
+		_, err = postProcess(config, reply)
+		logger = previous
+		if err != nil {
+			t.Fatalf("postProcess: %v", err)
+		}
+		if got := strings.Contains(buf.String(), "filter path does not match the reply"); got != wantWarn {
+			t.Errorf("-log-level %s: warned = %v, want %v (log: %q)", level, got, wantWarn, buf.String())
+		}
+	}
+}
+
+func TestRawBytesOutput(t *testing.T) {
+	// whitespace, quoting and entities a pretty-printer would change
+	const body = "\n  <data><x a='1'>t&amp;t </x>\r\n</data>\n"
+	tests := []struct {
+		name          string
+		caps          []string
+		keepDelimiter bool
+		want          func(sent string) string
+		wantErr       string
+	}{
+		{"1.0", []string{netconftest.Base10}, false, func(sent string) string { return sent }, ""},
+		{"1.0 with the delimiter", []string{netconftest.Base10}, true, func(sent string) string { return sent + "]]>]]>" }, ""},
+		{"1.1 de-framed", []string{netconftest.Base10, netconftest.Base11}, false, func(sent string) string { return sent }, ""},
+		{"1.1 with the delimiter", []string{netconftest.Base10, netconftest.Base11}, true, nil, "-keep-delimiter only applies to base:1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent string
+			d := netconftest.NewDevice(tt.caps...)
+			d.Handle = func(rpc string) []string {
+				sent = netconftest.Reply(rpc, body)
+				return []string{sent}
+			}
+			config := validConfig(func(c *Config) {
+				c.IP, c.File, c.Path = "127.0.0.1", "", "<get/>"
+				c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+				c.OutputFormat, c.KeepDelimiter = "raw-bytes", tt.keepDelimiter
+			})
+			captureLog(t)
+
+			got, err := runNetconfClient(config, &runMetrics{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("runNetconfClient error = %v, want %q", err, tt.wantErr)
+				}
+				for _, req := range d.Requests() {
+					if strings.Contains(req, "<get/>") {
+						t.Errorf("the RPC was sent before the framing was rejected: %q", req)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runNetconfClient: %v", err)
+			}
+			if want := tt.want(sent); got != want {
+				t.Errorf("raw output = %q, want the device's bytes %q", got, want)
+			}
+		})
+	}
+}
+
+func TestErrorReplyOutput(t *testing.T) {
+	d := netconftest.NewDevice()
+	d.Handle = func(rpc string) []string {
+		return []string{netconftest.Reply(rpc, "\n"+netconftest.RPCError("invalid-value", "bad  value")+"\n")}
+	}
+	_, err := connectFakeDevice(t, d).Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`)
+	var rpcErr *netconf.RPCError
+	if !errors.As(err, &rpcErr) {
+		t.Fatalf("Run error = %v, want *netconf.RPCError", err)
+	}
+
+	raw := errorReplyOutput(validConfig(func(c *Config) { c.OutputFormat = "raw-bytes" }), rpcErr)
+	if raw != rpcErr.Raw {
+		t.Errorf("raw-bytes error reply = %q, want it unchanged: %q", raw, rpcErr.Raw)
+	}
+	pretty := errorReplyOutput(validConfig(func(c *Config) {}), rpcErr)
+	if pretty == rpcErr.Raw || !strings.Contains(pretty, "<error-tag>invalid-value</error-tag>") {
+		t.Errorf("pretty error reply = %q, want it re-indented", pretty)
+	}
+}
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		spec                         string
+		wantUser, wantHost, wantPort string
+	}{
+		{"192.0.2.1", "", "192.0.2.1", ""},
+		{"192.0.2.1:2022", "", "192.0.2.1", "2022"},
+		{"admin@192.0.2.1", "admin", "192.0.2.1", ""},
+		{"admin@192.0.2.1:2022", "admin", "192.0.2.1", "2022"},
+		{"2001:db8::1", "", "2001:db8::1", ""},
+		{"[2001:db8::1]", "", "2001:db8::1", ""},
+		{"[2001:db8::1]:830", "", "2001:db8::1", "830"},
+		{"admin@[2001:db8::1]:830", "admin", "2001:db8::1", "830"},
+		{"router1.example.net:22", "", "router1.example.net", "22"},
+		{"ops@corp@router1", "ops@corp", "router1", ""},
+		{"192.0.2.1:", "", "192.0.2.1", ""},
+		{"192.0.2.1:ssh", "", "192.0.2.1", "ssh"},
+		{"@192.0.2.1", "", "192.0.2.1", ""},
+	}
+	for _, tt := range tests {
+		user, host, port := splitTarget(tt.spec)
+		if user != tt.wantUser || host != tt.wantHost || port != tt.wantPort {
+			t.Errorf("splitTarget(%q) = %q, %q, %q; want %q, %q, %q", tt.spec, user, host, port, tt.wantUser, tt.wantHost, tt.wantPort)
+		}
+	}
+}
+
+func TestValidateConfigPort(t *testing.T) {
+	tests := []struct {
+		port    string
+		wantErr bool
+	}{
+		{"830", false},
+		{"1", false},
+		{"65535", false},
+		{"", false},
+		{"0", true},
+		{"65536", true},
+		{"ssh", true},
+		{"-22", true},
+	}
+	for _, tt := range tests {
+		err := validateConfig(validConfig(func(c *Config) { c.Port = tt.port }))
+		if tt.wantErr != (err != nil) || err != nil && !strings.Contains(err.Error(), "invalid port") {
+			t.Errorf("validateConfig with port %q = %v, want error %v", tt.port, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseJumpHost(t *testing.T) {
+	tests := []struct {
+		spec, wantUser, wantAddr string
+	}{
+		{"bastion", "admin", "bastion:22"},
+		{"jump@bastion:2222", "jump", "bastion:2222"},
+		{"[2001:db8::10]", "admin", "[2001:db8::10]:22"},
+		{"jump@[2001:db8::10]:2222", "jump", "[2001:db8::10]:2222"},
+	}
+	for _, tt := range tests {
+		user, addr, err := parseJumpHost(tt.spec, "admin")
+		if err != nil || user != tt.wantUser || addr != tt.wantAddr {
+			t.Errorf("parseJumpHost(%q) = %q, %q, %v; want %q, %q", tt.spec, user, addr, err, tt.wantUser, tt.wantAddr)
+		}
+	}
+	for _, spec := range []string{"@bastion", "jump@"} {
+		if _, _, err := parseJumpHost(spec, "admin"); err == nil {
+			t.Errorf("parseJumpHost(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestApplySettingsPrecedence(t *testing.T) {
+	fc := loadInventory(t)
+	tests := []struct {
+		name       string
+		target     string
+		fileConfig *fileConfig
+		flags      map[string]string
+		wantUser   string
+		wantPort   string
+	}{
+		{"defaults only", "10.0.0.2", nil, nil, "admin", "830"},
+		{"host entry over defaults", "10.0.0.2", fc, nil, "ops", "2022"},
+		{"shorthand over defaults", "netops@10.0.0.2:3000", nil, nil, "netops", "3000"},
+		{"shorthand over host entry", "netops@10.0.0.2:3000", fc, nil, "netops", "3000"},
+		{"shorthand user only", "netops@10.0.0.2", fc, nil, "netops", "2022"},
+		{"flags over shorthand and host entry", "netops@10.0.0.2:3000", fc, map[string]string{"username": "root", "port": "4000"}, "root", "4000"},
+		{"port flag, shorthand user", "netops@10.0.0.2:3000", fc, map[string]string{"port": "4000"}, "netops", "4000"},
+		{"flags over host entry", "10.0.0.2", fc, map[string]string{"username": "root", "port": "4000"}, "root", "4000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, host, port := splitTarget(tt.target)
+			config := Config{IP: host, Username: "admin", Port: "830", fileConfig: tt.fileConfig, explicitFlags: map[string]bool{}}
+			// what flag.Parse leaves behind for the flags given
+			for name, value := range tt.flags {
+				config.explicitFlags[name] = true
+				switch name {
+				case "username":
+					config.Username = value
+				case "port":
+					config.Port = value
+				}
+			}
+			applySettings(&config, user, port)
+			if config.Username != tt.wantUser || config.Port != tt.wantPort {
+				t.Errorf("got %s port %s, want %s port %s", config.Username, config.Port, tt.wantUser, tt.wantPort)
+			}
+		})
+	}
+}
+
+// TestNewEndpointAlgorithms connects with -key-algorithm, -ciphers and -kex to an SSH device that accepts only
+// those, none of them crypto/ssh's defaults, so the handshake proves newEndpoint offered what was configured.
+func TestNewEndpointAlgorithms(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "test key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := netconftest.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &ssh.ServerConfig{
+		Config:                  ssh.Config{Ciphers: []string{"aes128-cbc"}, KeyExchanges: []string{"diffie-hellman-group1-sha1"}},
+		PublicKeyAuthAlgorithms: []string{ssh.KeyAlgoRSASHA512},
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	server.AddHostKey(hostKey)
+	ln, port, err := netconftest.NewDevice().ListenSSH("127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	captureLog(t)
+
+	config := validConfig(func(c *Config) {
+		c.IP, c.Port, c.Password, c.Key, c.HostKeyPolicy, c.Timeout = "127.0.0.1", port, "", keyPath, "ignore", 5
+		c.KeyAlgorithm, c.Ciphers, c.KeyExchanges = "rsa-sha2-512", "aes128-cbc", "diffie-hellman-group1-sha1"
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	s := newEndpoint(config)
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	s.Disconnect()
+
+	config.KeyAlgorithm = "rsa-sha2-256"
+	s = newEndpoint(config)
+	if err := s.Connect(); err == nil {
+		s.Disconnect()
+		t.Fatal("Connect with -key-algorithm rsa-sha2-256 succeeded against a server taking only rsa-sha2-512")
+	}
+}
+
+// TestPostProcessFilters applies two -filter values to one reply and expects a labelled section for each, in
+// the order given, holding only what that filter selected; a single filter gets no label.
+func TestPostProcessFilters(t *testing.T) {
+	const reply = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>` +
+		`<interfaces><interface><name>eth0</name></interface><interface><name>eth1</name></interface></interfaces>` +
+		`</data></rpc-reply>`
+	filters := []string{"/interfaces/interface[name='eth0']", "/interfaces/interface[name='eth1']"}
+	config := validConfig(func(c *Config) { c.Filters, c.Unwrap, c.Indent = filters, true, "2" })
+	got, err := postProcess(config, reply)
+	if err != nil {
+		t.Fatalf("postProcess: %v", err)
+	}
+	want := `<!-- filter: /interfaces/interface[name='eth0'] -->
+<interfaces>
+  <interface>
+    <name>eth0</name>
+  </interface>
+</interfaces>
+<!-- filter: /interfaces/interface[name='eth1'] -->
+<interfaces>
+  <interface>
+    <name>eth1</name>
+  </interface>
+</interfaces>`
+	if strings.TrimSpace(got) != want {
+		t.Errorf("postProcess =\n%s\nwant\n%s", got, want)
+	}
+
+	config.Filters = filters[1:]
+	got, err = postProcess(config, reply)
+	if err != nil {
+		t.Fatalf("postProcess: %v", err)
+	}
+	if strings.Contains(got, "<!-- filter:") || strings.Contains(got, "eth0") || !strings.Contains(got, "eth1") {
+		t.Errorf("postProcess with one filter = %q, want only eth1 and no label", got)
+	}
+}
+
+// TestStreamsRequiresNotifications runs -streams against a device with and without the :notification
+// capability; without it the run fails before the streams get is sent.
+func TestStreamsRequiresNotifications(t *testing.T) {
+	const streams = `<data><netconf xmlns="urn:ietf:params:xml:ns:netmod:notification"><streams>` +
+		`<stream><name>NETCONF</name></stream></streams></netconf></data>`
+	for _, supported := range []bool{true, false} {
+		caps := []string{netconftest.Base10}
+		if supported {
+			caps = append(caps, "urn:ietf:params:netconf:capability:notification:1.0")
+		}
+		d := netconftest.NewDevice(caps...)
+		d.Handle = func(rpc string) []string { return []string{netconftest.Reply(rpc, streams)} }
+		config := validConfig(func(c *Config) {
+			c.IP, c.File, c.Streams = "127.0.0.1", "", true
+			c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+		})
+		if err := validateConfig(config); err != nil {
+			t.Fatalf("validateConfig: %v", err)
+		}
+		captureLog(t)
+
+		got, err := runNetconfClient(config, &runMetrics{})
+		gets := 0
+		for _, req := range d.Requests() {
+			if strings.Contains(req, "<streams/>") {
+				gets++
+			}
+		}
+		if supported {
+			if err != nil {
+				t.Fatalf("runNetconfClient: %v", err)
+			}
+			if !strings.Contains(got, "<name>NETCONF</name>") || gets != 1 {
+				t.Errorf("-streams output = %q after %d gets, want the NETCONF stream from one get", got, gets)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), "device does not support notifications") {
+			t.Errorf("runNetconfClient error = %v, want the device does not support notifications", err)
+		}
+		if gets != 0 {
+			t.Errorf("the streams get was sent to a device without notifications")
+		}
+	}
+}
+
+// TestSaveCapabilities checks -save-capabilities writes the capabilities after a successful run only, unless
+// -capabilities-on-error is set, and that a failed save only warns.
+func TestSaveCapabilities(t *testing.T) {
+	tests := []struct {
+		name     string
+		rpcErr   bool
+		onError  bool
+		missing  bool // the -save-capabilities directory does not exist
+		wantFile bool
+	}{
+		{"success", false, false, false, true},
+		{"rpc failure", true, false, false, false},
+		{"rpc failure with -capabilities-on-error", true, true, false, true},
+		{"unwritable directory", false, false, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := netconftest.NewDevice()
+			d.Handle = func(rpc string) []string {
+				if tt.rpcErr {
+					return []string{netconftest.Reply(rpc, netconftest.RPCError("operation-failed", "rejected"))}
+				}
+				return []string{netconftest.Reply(rpc, "<data/>")}
+			}
+			dir := t.TempDir()
+			if tt.missing {
+				dir = filepath.Join(dir, "missing")
+			}
+			config := validConfig(func(c *Config) {
+				c.IP, c.File, c.Path = "127.0.0.1", "", "<get/>"
+				c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+				c.SaveCapabilities, c.CapabilitiesOnError = dir, tt.onError
+			})
+			log := captureLog(t)
+
+			_, err := runNetconfClient(config, &runMetrics{})
+			if tt.rpcErr != (err != nil) {
+				t.Fatalf("runNetconfClient error = %v, want failure %v", err, tt.rpcErr)
+			}
+			data, readErr := os.ReadFile(filepath.Join(dir, "127.0.0.1_capabilities.xml"))
+			if got := readErr == nil; got != tt.wantFile {
+				t.Fatalf("capabilities file written = %v, want %v", got, tt.wantFile)
+			}
+			if tt.wantFile && !strings.Contains(string(data), netconftest.Base11) {
+				t.Errorf("capabilities file = %q, want the device's capabilities", data)
+			}
+			if tt.missing && !strings.Contains(log.String(), "failed to write capabilities") {
+				t.Errorf("log = %q, want a warning about the failed save", log.String())
+			}
+		})
+	}
+}
+
+// TestDecodePayload decodes line-wrapped base64 and hex payloads both whole, as readRPCFile does, and as a
+// stream through whitespaceStripper, as streamRPCFile does.
+func TestDecodePayload(t *testing.T) {
+	const rpc = `<rpc message-id="101" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get-config><source><running/></source></get-config></rpc>`
+	wrap := func(s string) string {
+		var b strings.Builder
+		for len(s) > 40 {
+			b.WriteString(s[:40] + "\r\n")
+			s = s[40:]
+		}
+		return b.String() + s + "\n"
+	}
+	tests := []struct {
+		encoding string
+		data     string
+		wantErr  string
+	}{
+		{"", rpc, ""},
+		{"base64", wrap(base64.StdEncoding.EncodeToString([]byte(rpc))), ""},
+		{"hex", wrap(hex.EncodeToString([]byte(rpc))), ""},
+		{"base64", "PHJwYy8+!", "invalid base64 payload"},
+		{"hex", "3c72706", "invalid hex payload"},
+		{"rot13", rpc, `unknown encoding "rot13"`},
+	}
+	for _, tt := range tests {
+		got, err := decodePayload([]byte(tt.data), tt.encoding)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("decodePayload(%q, %s) error = %v, want %q", tt.data, tt.encoding, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || string(got) != rpc {
+			t.Errorf("decodePayload(%s) = %q, %v; want the rpc", tt.encoding, got, err)
+		}
+
+		var r io.Reader
+		switch tt.encoding {
+		case "base64":
+			r = base64.NewDecoder(base64.StdEncoding, newWhitespaceStripper(iotest.OneByteReader(strings.NewReader(tt.data))))
+		case "hex":
+			r = hex.NewDecoder(newWhitespaceStripper(iotest.OneByteReader(strings.NewReader(tt.data))))
+		default:
+			continue
+		}
+		if streamed, err := io.ReadAll(r); err != nil || string(streamed) != rpc {
+			t.Errorf("streamed %s decode = %q, %v; want the rpc", tt.encoding, streamed, err)
+		}
+	}
+}
+
+// TestGetData runs -get-data operational against devices with and without the NMDA capability.
+func TestGetData(t *testing.T) {
+	for _, nmda := range []bool{true, false} {
+		caps := []string{netconftest.Base10, netconftest.Base11}
+		if nmda {
+			caps = append(caps, netconf.NMDACapability+"?module=ietf-netconf-nmda&amp;revision=2019-01-07")
+		}
+		d := netconftest.NewDevice(caps...)
+		d.Handle = func(rpc string) []string { return []string{netconftest.Reply(rpc, "<data/>")} }
+		config := validConfig(func(c *Config) {
+			c.IP, c.File, c.Path = "127.0.0.1", "", `<system xmlns="urn:example"/>`
+			c.GetData, c.WithOrigin, c.WithDefaults = "operational", true, "trim"
+			c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+		})
+		captureLog(t)
+
+		_, err := runNetconfClient(config, &runMetrics{})
+		var getData []string
+		for _, req := range d.Requests() {
+			if strings.Contains(req, "<get-data") {
+				getData = append(getData, req)
+			}
+		}
+		if !nmda {
+			if err == nil || !strings.Contains(err.Error(), "required for get-data") || len(getData) > 0 {
+				t.Errorf("without NMDA: error = %v, %d get-data sent; want the capability error and none sent", err, len(getData))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("runNetconfClient: %v", err)
+		}
+		if len(getData) != 1 {
+			t.Fatalf("device received %d get-data rpcs, want 1", len(getData))
+		}
+		for _, want := range []string{"<datastore>ds:operational</datastore>", `<subtree-filter><system xmlns="urn:example"/></subtree-filter>`,
+			"<with-origin/>", ">trim</with-defaults>"} {
+			if !strings.Contains(getData[0], want) {
+				t.Errorf("get-data %q lacks %q", getData[0], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type runMetrics struct {
+	ConnectDuration time.Duration
+	RPCDuration     time.Duration
+	ReplyBytes      int
+	Success         bool
+}
+
+// formatMetrics renders the run metrics in the Prometheus text exposition format.
+func formatMetrics(m runMetrics, ip string) string {
+	labels := fmt.Sprintf(`{ip="%s"}`, escapeLabelValue(ip))
+	success := 0
+	if m.Success {
+		success = 1
+	}
+
+	metrics := []struct {
+		name  string
+		help  string
+		value string
+	}{
+		{"gonc_connect_duration_seconds", "Time spent establishing the NETCONF session.", fmt.Sprintf("%g", m.ConnectDuration.Seconds())},
+		{"gonc_rpc_duration_seconds", "Time spent waiting for the RPC reply.", fmt.Sprintf("%g", m.RPCDuration.Seconds())},
+		{"gonc_reply_bytes", "Size of the raw RPC reply in bytes.", fmt.Sprintf("%d", m.ReplyBytes)},
+		{"gonc_success", "Whether the last run completed successfully.", fmt.Sprintf("%d", success)},
+		{"gonc_last_run_timestamp_seconds", "Unix time the last run finished.", fmt.Sprintf("%d", time.Now().Unix())},
+	}
+
+	var b strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", metric.name)
+		fmt.Fprintf(&b, "%s%s %s\n", metric.name, labels, metric.value)
+	}
+	return b.String()
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+// writeMetricsFile writes the metrics atomically so the textfile collector never reads a partial file.
+func writeMetricsFile(path string, m runMetrics, ip string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary metrics file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(formatMetrics(m, ip)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file %s: %v", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics file %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move metrics file into place %s: %v", path, err)
+	}
+	return nil
+}
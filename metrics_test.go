@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	metricLine  = regexp.MustCompile(`^gonc_[a-z_]+\{ip="(?:[^"\\]|\\.)*"\} -?[0-9.e+-]+$`)
+	commentLine = regexp.MustCompile(`^# (HELP gonc_[a-z_]+ .+|TYPE gonc_[a-z_]+ gauge)$`)
+)
+
+func TestFormatMetricsLineFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		metrics   runMetrics
+		ip        string
+		wantLines []string
+	}{
+		{
+			name:    "successful run",
+			metrics: runMetrics{ConnectDuration: 1500 * time.Millisecond, RPCDuration: 250 * time.Millisecond, ReplyBytes: 2048, Success: true},
+			ip:      "192.0.2.1",
+			wantLines: []string{
+				`gonc_connect_duration_seconds{ip="192.0.2.1"} 1.5`,
+				`gonc_rpc_duration_seconds{ip="192.0.2.1"} 0.25`,
+				`gonc_reply_bytes{ip="192.0.2.1"} 2048`,
+				`gonc_success{ip="192.0.2.1"} 1`,
+			},
+		},
+		{
+			name:      "failed run with a label needing escapes",
+			metrics:   runMetrics{},
+			ip:        `odd"host\`,
+			wantLines: []string{`gonc_success{ip="odd\"host\\"} 0`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := formatMetrics(tt.metrics, tt.ip)
+			if !strings.HasSuffix(out, "\n") {
+				t.Error("metrics output must end with a newline")
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			for _, line := range lines {
+				if !metricLine.MatchString(line) && !commentLine.MatchString(line) {
+					t.Errorf("line %q is not in the Prometheus text format", line)
+				}
+			}
+			for _, want := range tt.wantLines {
+				if !strings.Contains(out, want+"\n") {
+					t.Errorf("metrics output lacks %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMetricsFileLeavesNoTemporaryFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gonc.prom")
+	if err := writeMetricsFile(path, runMetrics{Success: true}, "192.0.2.1"); err != nil {
+		t.Fatalf("writeMetricsFile: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "gonc.prom" {
+		t.Errorf("directory holds %v, want only gonc.prom", entries)
+	}
+}
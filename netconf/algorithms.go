@@ -0,0 +1,100 @@
+package netconf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHAlgorithms restricts the algorithms offered in the SSH handshake; an empty list keeps crypto/ssh's default.
+type SSHAlgorithms struct {
+	Ciphers      []string
+	KeyExchanges []string
+	MACs         []string
+	HostKeys     []string
+}
+
+// Algorithm names crypto/ssh implements, including the legacy ones it leaves out of its defaults.
+var (
+	SupportedCiphers = []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr",
+		"aes128-cbc", "3des-cbc", "arcfour256", "arcfour128", "arcfour",
+	}
+	SupportedKeyExchanges = []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group16-sha512", "diffie-hellman-group14-sha1",
+		"diffie-hellman-group1-sha1", "diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1",
+	}
+	SupportedMACs = []string{
+		"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256", "hmac-sha2-512", "hmac-sha1", "hmac-sha1-96",
+	}
+	SupportedHostKeys = []string{
+		ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+		ssh.CertAlgoED25519v01, ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01,
+		ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01,
+	}
+)
+
+// LegacyAlgorithms are the modern defaults followed by the CBC ciphers, SHA-1 key exchanges and ssh-rsa/ssh-dss
+// host keys that older Cisco and Juniper gear is often limited to. Modern algorithms stay first, so a device
+// that supports them still gets them.
+var LegacyAlgorithms = SSHAlgorithms{
+	Ciphers: []string{
+		"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "chacha20-poly1305@openssh.com",
+		"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-cbc", "3des-cbc",
+	},
+	KeyExchanges: []string{
+		"curve25519-sha256", "curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256", "ecdh-sha2-nistp384", "ecdh-sha2-nistp521",
+		"diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1",
+		"diffie-hellman-group-exchange-sha256", "diffie-hellman-group-exchange-sha1", "diffie-hellman-group1-sha1",
+	},
+	MACs: SupportedMACs,
+	HostKeys: []string{
+		ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+		ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+	},
+}
+
+// validate rejects algorithm names crypto/ssh doesn't implement, which it would otherwise drop silently.
+func (a SSHAlgorithms) validate() error {
+	for _, set := range []struct {
+		kind      string
+		names     []string
+		supported []string
+	}{
+		{"cipher", a.Ciphers, SupportedCiphers},
+		{"key exchange", a.KeyExchanges, SupportedKeyExchanges},
+		{"MAC", a.MACs, SupportedMACs},
+		{"host key algorithm", a.HostKeys, SupportedHostKeys},
+	} {
+		for _, name := range set.names {
+			if !slices.Contains(set.supported, name) {
+				return fmt.Errorf("unknown SSH %s %q; use one of %s", set.kind, name, strings.Join(set.supported, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// apply sets the non-empty algorithm lists on config.
+func (a SSHAlgorithms) apply(config *ssh.ClientConfig) {
+	if len(a.Ciphers) > 0 {
+		config.Ciphers = a.Ciphers
+	}
+	if len(a.KeyExchanges) > 0 {
+		config.KeyExchanges = a.KeyExchanges
+	}
+	if len(a.MACs) > 0 {
+		config.MACs = a.MACs
+	}
+	if len(a.HostKeys) > 0 {
+		config.HostKeyAlgorithms = a.HostKeys
+	}
+}
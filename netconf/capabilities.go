@@ -0,0 +1,184 @@
+package netconf
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const netconfCapabilityPrefix = "urn:ietf:params:netconf:capability:"
+
+// Capability is a single capability URI from the server hello, split into its parts.
+// YANG module capabilities carry their module, revision, features and deviations as query parameters.
+type Capability struct {
+	URI        string
+	Base       string
+	Module     string
+	Revision   string
+	Features   []string
+	Deviations []string
+	Params     url.Values
+}
+
+func parseCapability(uri string) Capability {
+	uri = strings.TrimSpace(uri)
+	c := Capability{URI: uri, Base: uri, Params: url.Values{}}
+
+	base, query, found := strings.Cut(uri, "?")
+	if !found {
+		return c
+	}
+	c.Base = base
+
+	// &amp; is already decoded by the XML parser, but some devices double-escape it
+	params, _ := url.ParseQuery(strings.ReplaceAll(query, "&amp;", "&"))
+	c.Params = params
+	c.Module = params.Get("module")
+	c.Revision = params.Get("revision")
+	if v := params.Get("features"); v != "" {
+		c.Features = strings.Split(v, ",")
+	}
+	if v := params.Get("deviations"); v != "" {
+		c.Deviations = strings.Split(v, ",")
+	}
+	return c
+}
+
+// ParseCapabilities parses capability URIs as listed in a hello, skipping blank entries.
+func ParseCapabilities(uris []string) []Capability {
+	caps := make([]Capability, 0, len(uris))
+	for _, uri := range uris {
+		if strings.TrimSpace(uri) != "" {
+			caps = append(caps, parseCapability(uri))
+		}
+	}
+	return caps
+}
+
+// matches reports whether the capability satisfies uri. A leading ":" is shorthand for a standard
+// NETCONF capability (":candidate", ":writable-running", ":base:1.1"), and a missing version suffix
+// matches any version. Full URIs, URI prefixes and bare YANG module names are also accepted.
+func (c Capability) matches(uri string) bool {
+	if strings.HasPrefix(uri, ":") {
+		name := uri[1:]
+		for _, candidate := range []string{netconfCapabilityPrefix + name, "urn:ietf:params:netconf:" + name} {
+			if c.Base == candidate || strings.HasPrefix(c.Base, candidate+":") {
+				return true
+			}
+		}
+		return false
+	}
+
+	return c.Base == uri ||
+		strings.HasPrefix(c.Base, uri+":") ||
+		strings.HasPrefix(c.URI, uri) ||
+		(c.Module != "" && c.Module == uri)
+}
+
+// MissingCapabilities returns the required capabilities that none of the advertised capabilities match.
+func MissingCapabilities(capabilities []Capability, required []string) []string {
+	var missing []string
+	for _, req := range required {
+		found := false
+		for _, c := range capabilities {
+			if c.matches(req) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, req)
+		}
+	}
+	return missing
+}
+
+// HasCapability reports whether the device advertised a capability matching uri, see Capability.matches.
+func (s *Endpoint) HasCapability(uri string) bool {
+	return len(MissingCapabilities(s.ParsedCapabilities, []string{uri})) == 0
+}
+
+// CapabilityURIs returns the capability URIs advertised by the device.
+func (s *Endpoint) CapabilityURIs() []string {
+	uris := make([]string, 0, len(s.ParsedCapabilities))
+	for _, c := range s.ParsedCapabilities {
+		uris = append(uris, c.URI)
+	}
+	return uris
+}
+
+// CapabilityChange is a capability advertised before and after with different parameters,
+// e.g. a YANG module whose revision or features changed.
+type CapabilityChange struct {
+	Old, New Capability
+}
+
+// CapabilityDiff lists the capabilities added, removed and changed between two hellos.
+type CapabilityDiff struct {
+	Added   []Capability
+	Removed []Capability
+	Changed []CapabilityChange
+}
+
+// Empty reports whether both hellos advertised the same capabilities.
+func (d CapabilityDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// key identifies a capability across hellos: YANG modules by module name, so a new revision is a change
+// rather than a removal plus an addition, everything else by base URI.
+func (c Capability) key() string {
+	if c.Module != "" {
+		return "module:" + c.Module
+	}
+	return c.Base
+}
+
+// DiffCapabilities compares the capabilities of an earlier and a later hello, each result sorted by module or URI.
+func DiffCapabilities(before, after []Capability) CapabilityDiff {
+	oldByKey := make(map[string]Capability, len(before))
+	for _, c := range before {
+		oldByKey[c.key()] = c
+	}
+	newByKey := make(map[string]Capability, len(after))
+	for _, c := range after {
+		newByKey[c.key()] = c
+	}
+
+	var d CapabilityDiff
+	for k, c := range newByKey {
+		prev, ok := oldByKey[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, c)
+		case !sameCapability(prev, c):
+			d.Changed = append(d.Changed, CapabilityChange{Old: prev, New: c})
+		}
+	}
+	for k, c := range oldByKey {
+		if _, ok := newByKey[k]; !ok {
+			d.Removed = append(d.Removed, c)
+		}
+	}
+
+	byKey := func(a, b Capability) int { return strings.Compare(a.key(), b.key()) }
+	slices.SortFunc(d.Added, byKey)
+	slices.SortFunc(d.Removed, byKey)
+	slices.SortFunc(d.Changed, func(a, b CapabilityChange) int { return byKey(a.New, b.New) })
+	return d
+}
+
+// sameCapability compares the parts that matter, so reordered features or query parameters aren't a change.
+func sameCapability(a, b Capability) bool {
+	if a.Base != b.Base || a.Revision != b.Revision {
+		return false
+	}
+	return sameSet(a.Features, b.Features) && sameSet(a.Deviations, b.Deviations)
+}
+
+func sameSet(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
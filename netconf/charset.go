@@ -0,0 +1,60 @@
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+var xmlDeclEncoding = regexp.MustCompile(`^(<\?xml[^>]*?encoding\s*=\s*["'])([^"']+)(["'])`)
+
+// replyEncoding returns the non-UTF-8 encoding label of an XML reply, or "" if it is already UTF-8.
+func replyEncoding(data string) string {
+	switch {
+	case strings.HasPrefix(data, "\xfe\xff"), strings.HasPrefix(data, "\x00<"):
+		return "utf-16be"
+	case strings.HasPrefix(data, "\xff\xfe"), strings.HasPrefix(data, "<\x00"):
+		return "utf-16le"
+	}
+
+	m := xmlDeclEncoding.FindStringSubmatch(strings.TrimPrefix(data, "\xef\xbb\xbf"))
+	if m == nil {
+		return ""
+	}
+	label := strings.ToLower(strings.TrimSpace(m[2]))
+	if label == "utf-8" || label == "utf8" {
+		return ""
+	}
+	return label
+}
+
+// ToUTF8 converts a reply declared (or BOM-marked) as a non-UTF-8 encoding to UTF-8.
+// The XML declaration is rewritten to say UTF-8 so later parsing does not try to convert it again.
+func ToUTF8(reply string) (string, error) {
+	label := replyEncoding(reply)
+	if label == "" {
+		return reply, nil
+	}
+
+	body, trailer := reply, ""
+	if idx := strings.LastIndex(reply, "]]>]]>"); idx != -1 {
+		body, trailer = reply[:idx], reply[idx:]
+	}
+
+	r, err := charset.NewReaderLabel(label, strings.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("unsupported reply encoding %q: %v", label, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s reply: %v", label, err)
+	}
+
+	decoded = bytes.TrimPrefix(decoded, []byte("\xef\xbb\xbf"))
+	decoded = xmlDeclEncoding.ReplaceAll(decoded, []byte("${1}UTF-8${3}"))
+	return string(decoded) + trailer, nil
+}
@@ -0,0 +1,60 @@
+package netconf
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 with a byte order mark.
+func encodeUTF16(s string, order binary.ByteOrder) string {
+	units := utf16.Encode([]rune("\ufeff" + s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(b[2*i:], u)
+	}
+	return string(b)
+}
+
+func TestToUTF8(t *testing.T) {
+	const utf8Reply = `<?xml version="1.0" encoding="UTF-8"?><rpc-reply><data><descr>Zürich – 東京</descr></data></rpc-reply>`
+	tests := []struct {
+		name  string
+		reply string
+		want  string
+	}{
+		{"utf-8 left alone", utf8Reply, utf8Reply},
+		{
+			name:  "utf-16le with BOM",
+			reply: encodeUTF16(`<?xml version="1.0" encoding="UTF-16"?><rpc-reply><data><descr>Zürich – 東京</descr></data></rpc-reply>`, binary.LittleEndian),
+			want:  utf8Reply,
+		},
+		{
+			name:  "utf-16be with BOM",
+			reply: encodeUTF16(`<?xml version="1.0" encoding="UTF-16"?><rpc-reply><data><descr>Zürich – 東京</descr></data></rpc-reply>`, binary.BigEndian),
+			want:  utf8Reply,
+		},
+		{
+			name:  "latin-1 declared",
+			reply: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rpc-reply><data><descr>Z\xfcrich</descr></data></rpc-reply>",
+			want:  `<?xml version="1.0" encoding="UTF-8"?><rpc-reply><data><descr>Zürich</descr></data></rpc-reply>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToUTF8(tt.reply)
+			if err != nil {
+				t.Fatalf("ToUTF8: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ToUTF8 = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToUTF8UnknownEncoding(t *testing.T) {
+	if _, err := ToUTF8(`<?xml version="1.0" encoding="x-made-up"?><rpc-reply/>`); err == nil {
+		t.Fatal("ToUTF8 accepted an unknown encoding")
+	}
+}
@@ -0,0 +1,118 @@
+package netconf
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+	"gopkg.in/yaml.v3"
+)
+
+// ReplyToMap converts an XML reply (or several concatenated documents) into nested maps keyed by element
+// local name. Leaf elements become strings, repeated siblings become slices, attributes are stored under
+// "@name" and the text of mixed-content elements under "#text". Namespace declarations and comments are dropped.
+func ReplyToMap(reply string) (map[string]any, error) {
+	if idx := strings.Index(reply, "]]>]]>"); idx != -1 {
+		reply = reply[:idx]
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(reply))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	type frame struct {
+		name     string
+		fields   map[string]any
+		text     strings.Builder
+		children bool
+	}
+	root := &frame{fields: map[string]any{}}
+	stack := []*frame{root}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse reply: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			f := &frame{name: t.Name.Local, fields: map[string]any{}}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				f.fields["@"+attr.Name.Local] = attr.Value
+			}
+			stack[len(stack)-1].children = true
+			stack = append(stack, f)
+		case xml.CharData:
+			stack[len(stack)-1].text.Write(t)
+		case xml.EndElement:
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			var value any
+			text := strings.TrimSpace(f.text.String())
+			if len(f.fields) == 0 && !f.children {
+				value = text
+			} else {
+				if text != "" {
+					f.fields["#text"] = text
+				}
+				value = f.fields
+			}
+
+			parent := stack[len(stack)-1].fields
+			switch existing := parent[f.name].(type) {
+			case nil:
+				parent[f.name] = value
+			case []any:
+				parent[f.name] = append(existing, value)
+			default:
+				parent[f.name] = []any{existing, value}
+			}
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("failed to parse reply: unexpected end of document")
+	}
+	return root.fields, nil
+}
+
+// ReplyToJSON is ReplyToMap rendered as indented JSON.
+func ReplyToJSON(reply string) (string, error) {
+	m, err := ReplyToMap(reply)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ReplyToYAML is ReplyToMap rendered as YAML: repeated elements become sequences and leaf text becomes scalars.
+func ReplyToYAML(reply string) (string, error) {
+	m, err := ReplyToMap(reply)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(m); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,45 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Dialer opens the byte stream a session runs over in place of the built-in SSH and TLS transports,
+// e.g. an in-memory fake that replays canned replies in tests. Close on the stream ends the session.
+// As with a socket, writes mustn't wait for the peer to read: the client hello is sent before the server's is read.
+type Dialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// connectDialer runs the hello exchange over the stream returned by s.Dialer.
+func (s *Endpoint) connectDialer(ctx context.Context) error {
+	conn, err := s.Dialer(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, err)
+	}
+	s.dialedConn = conn
+	s.SshIn = conn
+	s.SshOut = conn
+
+	// the hello exchange doesn't take a context, closing the stream is what interrupts it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := s.exchangeHello(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if !stop() {
+		conn.Close()
+		return ctx.Err()
+	}
+	s.logger().Info("connected", "transport", "dialer", "session-id", s.RemoteSessionID, "base-version", s.BaseVersion())
+	return nil
+}
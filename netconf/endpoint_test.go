@@ -0,0 +1,678 @@
+package netconf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	testHelloPrefix = netconftest.HelloPrefix
+	okBody          = netconftest.OK
+	rpcErrorBody    = netconftest.RPCError("operation-failed", "boom")
+	reply           = netconftest.Reply
+)
+
+// quietLogger keeps the session's lifecycle logs out of the test output.
+func quietLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// connectFake returns an Endpoint connected to f, disconnected when the test ends.
+func connectFake(t *testing.T, f *netconftest.Device, opts ...Option) *Endpoint {
+	t.Helper()
+	opts = append([]Option{WithDialer(f.Dial), WithLogger(quietLogger()), WithRPCTimeout(5)}, opts...)
+	s := NewEndpoint("127.0.0.1", opts...)
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(s.Disconnect)
+	return s
+}
+
+func TestEndpointOverFakeTransport(t *testing.T) {
+	tests := []struct {
+		name        string
+		caps        []string
+		body        string
+		wantFraming string
+		wantRPCErr  bool
+	}{
+		{"1.0 ok reply", []string{baseCapability10}, okBody, "1.0", false},
+		{"1.0 rpc-error", []string{baseCapability10}, rpcErrorBody, "1.0", true},
+		{"1.1 ok reply", []string{baseCapability10, baseCapability11}, okBody, "1.1", false},
+		{"1.1 rpc-error", []string{baseCapability10, baseCapability11}, rpcErrorBody, "1.1", true},
+		{"1.1 data reply", []string{baseCapability11}, `<data><x>1</x></data>`, "1.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(tt.caps...)
+			f.Handle = func(rpc string) []string { return []string{reply(rpc, tt.body)} }
+			s := connectFake(t, f)
+
+			if s.FramingVersion != tt.wantFraming {
+				t.Fatalf("FramingVersion = %q, want %q", s.FramingVersion, tt.wantFraming)
+			}
+			if s.SessionID() != 42 {
+				t.Errorf("SessionID() = %d, want 42", s.SessionID())
+			}
+			if !strings.HasPrefix(s.Capabilities, testHelloPrefix) || strings.Contains(s.Capabilities, "]]>]]>") {
+				t.Errorf("Capabilities = %q, want the bare server hello", s.Capabilities)
+			}
+
+			got, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`)
+			var rpcErr *RPCError
+			if tt.wantRPCErr {
+				if !errors.As(err, &rpcErr) {
+					t.Fatalf("Run error = %v, want *RPCError", err)
+				}
+				if rpcErr.Tag != "operation-failed" || rpcErr.Message != "boom" {
+					t.Errorf("RPCError = %+v", rpcErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if want := `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + tt.body + `</rpc-reply>`; got != want {
+				t.Errorf("Run reply = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestRunReplyCutOff(t *testing.T) {
+	const partial = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><x>1</x>`
+	tests := []struct {
+		name string
+		caps []string
+		sent string
+	}{
+		{"1.0 without the delimiter", []string{baseCapability10}, partial},
+		{"1.1 inside a chunk", []string{baseCapability11}, fmt.Sprintf("\n#%d\n%s", len(partial)+100, partial)},
+		{"1.1 without the end-of-chunks", []string{baseCapability11}, fmt.Sprintf("\n#%d\n%s", len(partial), partial)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(tt.caps...)
+			f.CutOff = func(string) string { return tt.sent }
+			s := connectFake(t, f)
+			if got, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("Run = %q, %v; want an io.ErrUnexpectedEOF error", got, err)
+			}
+
+			f = netconftest.NewDevice(tt.caps...)
+			f.CutOff = func(string) string { return tt.sent }
+			s = connectFake(t, f)
+			var out strings.Builder
+			if err := s.RunStream(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`, &out); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("RunStream error = %v, want io.ErrUnexpectedEOF", err)
+			}
+			if out.String() != partial {
+				t.Errorf("RunStream wrote %q, want the partial reply %q", out.String(), partial)
+			}
+		})
+	}
+}
+
+// largeEditConfig returns an edit-config rpc of at least size bytes.
+func largeEditConfig(size int) string {
+	var b strings.Builder
+	b.WriteString(`<rpc message-id="101" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><edit-config><target><running/></target><config>`)
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, `<interface><name>eth%d</name><description>uplink %d to the aggregation layer</description></interface>`, i, i)
+	}
+	b.WriteString(`</config></edit-config></rpc>`)
+	return b.String()
+}
+
+func TestRunReaderLargePayload(t *testing.T) {
+	payload := largeEditConfig(8 << 20)
+	for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+		f := netconftest.NewDevice(caps...)
+		s := connectFake(t, f)
+		if _, err := s.RunReader(strings.NewReader(payload)); err != nil {
+			t.Fatalf("caps %v: RunReader: %v", caps, err)
+		}
+		if reqs := f.Requests(); len(reqs) != 1 || reqs[0] != payload {
+			t.Errorf("caps %v: the device did not receive the %d-byte payload intact", caps, len(payload))
+		}
+	}
+}
+
+// TestRunReaderWrapsBareOperation streams a bare edit-config, with an XML declaration in front and a delimiter
+// behind, through WrapRPCReader and checks the device receives it in a tagged <rpc> envelope, and that an <rpc>
+// without a message-id is tagged too.
+func TestRunReaderWrapsBareOperation(t *testing.T) {
+	rpc := largeEditConfig(256 << 10)
+	body := strings.TrimSuffix(rpc[strings.Index(rpc, "<edit-config>"):], "</rpc>")
+	open := `<rpc message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">`
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"bare", `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + body + "\n]]>]]>\n", open + body + "</rpc>"},
+		{"rpc without message-id", `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + body + "</rpc>", open + body + "</rpc>"},
+		{"rpc with message-id", rpc, rpc},
+	}
+	for _, tt := range tests {
+		for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+			f := netconftest.NewDevice(caps...)
+			s := connectFake(t, f)
+			r, err := WrapRPCReader(iotest.HalfReader(strings.NewReader(tt.payload)))
+			if err != nil {
+				t.Fatalf("%s, caps %v: WrapRPCReader: %v", tt.name, caps, err)
+			}
+			if _, err := s.RunReader(r); err != nil {
+				t.Fatalf("%s, caps %v: RunReader: %v", tt.name, caps, err)
+			}
+			if reqs := f.Requests(); len(reqs) != 1 || reqs[0] != tt.want {
+				t.Errorf("%s, caps %v: the device did not receive the %d-byte rpc as expected", tt.name, caps, len(tt.want))
+			}
+		}
+	}
+	if _, err := WrapRPCReader(strings.NewReader("<!-- nothing -->")); err == nil || !strings.Contains(err.Error(), "no XML element") {
+		t.Errorf("WrapRPCReader error = %v, want no XML element reported", err)
+	}
+}
+
+// BenchmarkRunReader streams a 4 MB rpc; compare with BenchmarkRunReadAll, which holds the whole payload first.
+func BenchmarkRunReader(b *testing.B) {
+	payload := largeEditConfig(4 << 20)
+	s := benchmarkEndpoint(b)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.RunReader(strings.NewReader(payload)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRunReadAll(b *testing.B) {
+	payload := largeEditConfig(4 << 20)
+	s := benchmarkEndpoint(b)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := io.ReadAll(strings.NewReader(payload))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := s.Run(string(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkEndpoint connects to a chunked-framing fake device answering <ok/>.
+func benchmarkEndpoint(b *testing.B) *Endpoint {
+	b.Helper()
+	s := NewEndpoint("127.0.0.1", WithDialer(netconftest.NewDevice().Dial), WithLogger(quietLogger()))
+	if err := s.Connect(); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(s.Disconnect)
+	return s
+}
+
+func TestEndpointOverTLS(t *testing.T) {
+	f := netconftest.NewDevice()
+	ln, port, err := f.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s := NewEndpoint("127.0.0.1", WithTLS("", "", ""), WithPort(port), WithHostKeyPolicy("ignore", ""), WithLogger(quietLogger()))
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer s.Disconnect()
+	if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if s.FramingVersion != "1.1" {
+		t.Errorf("FramingVersion = %q, want 1.1", s.FramingVersion)
+	}
+}
+
+func TestBaseVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []string
+		want string
+	}{
+		{"both offered", []string{baseCapability10, baseCapability11}, "1.1"},
+		{"only 1.0 offered", []string{baseCapability10}, "1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewEndpoint("127.0.0.1", WithDialer(netconftest.NewDevice(tt.caps...).Dial), WithLogger(quietLogger()))
+			if got := s.BaseVersion(); got != "" {
+				t.Errorf("BaseVersion() before Connect = %q, want empty", got)
+			}
+			if err := s.Connect(); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			defer s.Disconnect()
+			if got := s.BaseVersion(); got != tt.want {
+				t.Errorf("BaseVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeviceClosesAfterHello(t *testing.T) {
+	for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+		f := netconftest.NewDevice(caps...)
+		f.CloseAfterHello = true
+		s := connectFake(t, f)
+		if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); !errors.Is(err, ErrChannelClosed) {
+			t.Errorf("caps %v: Run error = %v, want ErrChannelClosed", caps, err)
+		}
+	}
+
+	// over TCP the write may still succeed, the closed channel then shows on the read
+	f := netconftest.NewDevice()
+	f.CloseAfterHello = true
+	ln, port, err := f.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := NewEndpoint("127.0.0.1", WithTLS("", "", ""), WithPort(port), WithHostKeyPolicy("ignore", ""), WithLogger(quietLogger()))
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer s.Disconnect()
+	if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); !errors.Is(err, ErrChannelClosed) {
+		t.Errorf("TLS: Run error = %v, want ErrChannelClosed", err)
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		wantErr string
+	}{
+		{"192.0.2.1", ""},
+		{"2001:db8::1", ""},
+		{"[2001:db8::1]", ""},
+		{"::1", ""},
+		{"router1.example.net", ""},
+		{"router1", ""},
+		{"", "no address provided"},
+		{"192.0.2.256", "not a valid IPv4 or IPv6 address"},
+		{"192.0.2", "not a valid IPv4 or IPv6 address"},
+		{"2001:db8::g1", "not a valid IPv4 or IPv6 address"},
+		{"192.0.2.1:830", "not a valid IPv4 or IPv6 address"},
+		{"-router1", "cannot start or end with '-'"},
+		{"router_1", "invalid character"},
+	}
+	for _, tt := range tests {
+		err := validateAddress(tt.addr)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateAddress(%q): %v", tt.addr, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateAddress(%q) error = %v, want it to mention %q", tt.addr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRunReplyIsStandaloneXML(t *testing.T) {
+	const ifNamespace = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+	body := `<data><if:interfaces xmlns:if="` + ifNamespace + `"><if:interface><if:name>eth0</if:name></if:interface></if:interfaces></data>`
+	for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+		f := netconftest.NewDevice(caps...)
+		f.Handle = func(rpc string) []string { return []string{reply(rpc, body)} }
+		s := connectFake(t, f)
+		got, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`)
+		if err != nil {
+			t.Fatalf("caps %v: Run: %v", caps, err)
+		}
+
+		// the reply and its pretty-printed form, as gonc writes it, must parse token by token up to EOF, with the
+		// namespaces resolved as the device declared them
+		for _, doc := range []string{got, FormatXML(got)} {
+			spaces := map[string]string{}
+			decoder := xml.NewDecoder(strings.NewReader(doc))
+			for {
+				token, err := decoder.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("caps %v: not standalone XML: %v\n%q", caps, err, doc)
+				}
+				if start, ok := token.(xml.StartElement); ok {
+					spaces[start.Name.Local] = start.Name.Space
+				}
+			}
+			if spaces["rpc-reply"] != baseNamespace || spaces["data"] != baseNamespace || spaces["interfaces"] != ifNamespace || spaces["name"] != ifNamespace {
+				t.Errorf("caps %v: element namespaces = %v in %q", caps, spaces, doc)
+			}
+		}
+	}
+}
+
+// listenSSH serves f over SSH with config until the test ends and returns the port.
+func listenSSH(t *testing.T, f *netconftest.Device, config *ssh.ServerConfig) string {
+	t.Helper()
+	ln, port, err := f.ListenSSH("127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return port
+}
+
+func TestEncryptedPrivateKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(priv, "test key", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostKey, err := netconftest.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), sshPub.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	port := listenSSH(t, netconftest.NewDevice(), config)
+
+	tests := []struct {
+		name       string
+		passphrase string
+		wantErr    string
+	}{
+		{"correct passphrase", "s3cret", ""},
+		{"wrong passphrase", "guess", "wrong passphrase for key " + keyPath},
+		{"no passphrase", "", "key " + keyPath + " is encrypted; provide its passphrase"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", ""), WithPrivateKey(keyPath, tt.passphrase),
+				WithHostKeyPolicy("ignore", ""), WithTimeout(5), WithLogger(quietLogger()))
+			err := s.Connect()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Connect: %v", err)
+				}
+				defer s.Disconnect()
+				if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); err != nil {
+					t.Errorf("Run over SSH: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				s.Disconnect()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Connect error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeRSAKey writes a fresh unencrypted RSA private key to a temp file and returns its path and public key.
+func writeRSAKey(t *testing.T) (string, ssh.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "test key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPath, pub
+}
+
+// TestKeyAlgorithms has a server that only takes one RSA signature algorithm and offers only a cipher and key
+// exchange crypto/ssh leaves out of its defaults, so a handshake only completes with what the options configured.
+func TestKeyAlgorithms(t *testing.T) {
+	keyPath, pub := writeRSAKey(t)
+	hostKey, err := netconftest.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		Config:                  ssh.Config{Ciphers: []string{"aes128-cbc"}, KeyExchanges: []string{"diffie-hellman-group14-sha1"}},
+		PublicKeyAuthAlgorithms: []string{ssh.KeyAlgoRSASHA512},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), pub.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	port := listenSSH(t, netconftest.NewDevice(), config)
+	legacy := SSHAlgorithms{Ciphers: []string{"aes128-cbc"}, KeyExchanges: []string{"diffie-hellman-group14-sha1"}}
+
+	tests := []struct {
+		name       string
+		keyAlgos   []string
+		algorithms SSHAlgorithms
+		wantErr    string
+	}{
+		{"configured algorithms", []string{ssh.KeyAlgoRSASHA512}, legacy, ""},
+		{"other key algorithm", []string{ssh.KeyAlgoRSASHA256}, legacy, "signer only supports [rsa-sha2-256]"},
+		{"default cipher and kex", []string{ssh.KeyAlgoRSASHA512}, SSHAlgorithms{}, "no common algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", ""), WithPrivateKey(keyPath, ""),
+				WithKeyAlgorithms(tt.keyAlgos...), WithSSHAlgorithms(tt.algorithms),
+				WithHostKeyPolicy("ignore", ""), WithTimeout(5), WithLogger(quietLogger()))
+			err := s.Connect()
+			if err == nil {
+				s.Disconnect()
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Connect: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Connect error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConnectTimeout(t *testing.T) {
+	// the listener takes connections into its backlog but never answers, so the handshake stalls
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	for name, transport := range map[string]Option{"ssh": func(*Endpoint) {}, "tls": WithTLS("", "", "")} {
+		s := NewEndpoint("127.0.0.1", transport, WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("ignore", ""),
+			WithTimeout(1), WithLogger(quietLogger()))
+		start := time.Now()
+		err := s.Connect()
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("%s: Connect took %v with a 1s timeout", name, elapsed)
+		}
+		var netErr net.Error
+		if err == nil || !(errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()) {
+			t.Errorf("%s: Connect error = %v, want a timeout", name, err)
+		}
+		if err == nil {
+			s.Disconnect()
+		}
+	}
+
+	for _, timeout := range []int{0, -5} {
+		s := NewEndpoint("127.0.0.1", WithPort(port), WithTimeout(timeout), WithLogger(quietLogger()))
+		if err := s.Connect(); err == nil || !strings.Contains(err.Error(), "timeout must be a positive number of seconds") {
+			t.Errorf("Connect with timeout %d error = %v, want it rejected", timeout, err)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	newDevice := func(caps ...string) *netconftest.Device {
+		f := netconftest.NewDevice(caps...)
+		// take the rpc, never answer it
+		f.Handle = func(string) []string { return []string{} }
+		return f
+	}
+	check := func(t *testing.T, s *Endpoint) {
+		t.Helper()
+		start := time.Now()
+		_, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`)
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Errorf("Run took %v with a 1s rpc timeout", elapsed)
+		}
+		if !errors.Is(err, os.ErrDeadlineExceeded) || !strings.Contains(err.Error(), "no complete reply received within 1s") {
+			t.Errorf("Run error = %v, want the rpc timeout", err)
+		}
+		// the session is closed under the abandoned read, so the next rpc must not go out on it
+		if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); !errors.Is(err, ErrSessionAbandoned) {
+			t.Errorf("Run after the timeout error = %v, want ErrSessionAbandoned", err)
+		}
+	}
+
+	for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+		check(t, connectFake(t, newDevice(caps...), WithRPCTimeout(1)))
+	}
+
+	port := listenSSH(t, newDevice(), nil)
+	s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("ignore", ""),
+		WithRPCTimeout(1), WithLogger(quietLogger()))
+	if err := s.Connect(); err != nil {
+		t.Fatalf("Connect over SSH: %v", err)
+	}
+	defer s.Disconnect()
+	check(t, s)
+}
+
+// TestRequestPty connects to a device that refuses NETCONF without a pty: WithPty gets the session going, with the
+// pty requested first, and the default term and size fill in for zero values.
+func TestRequestPty(t *testing.T) {
+	tests := []struct {
+		name          string
+		term          string
+		width, height int
+		wantPty       string
+	}{
+		{"configured", "xterm", 132, 50, "pty-req xterm 132x50"},
+		{"defaults", "", 0, 0, "pty-req vt100 80x24"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice()
+			f.RequirePty = true
+			port := listenSSH(t, f, nil)
+
+			s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("ignore", ""),
+				WithPty(tt.term, tt.width, tt.height), WithTimeout(5), WithLogger(quietLogger()))
+			if err := s.Connect(); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+			defer s.Disconnect()
+			if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if got, want := f.SessionRequests(), []string{tt.wantPty, "subsystem netconf"}; !slices.Equal(got, want) {
+				t.Errorf("session requests = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// TestNetconfCommand connects to a device that only runs NETCONF through an exec command, as legacy Junos does.
+func TestNetconfCommand(t *testing.T) {
+	const command = "xml-mode netconf need-trailer"
+	tests := []struct {
+		name     string
+		command  string
+		wantReqs []string
+	}{
+		{"exec command", command, []string{"exec " + command}},
+		{"subsystem", "", []string{"subsystem netconf"}},
+		{"other command", "netconf", []string{"exec netconf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice()
+			f.ExecCommand = command
+			port := listenSSH(t, f, nil)
+
+			s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("ignore", ""),
+				WithNetconfCommand(tt.command), WithTimeout(5), WithLogger(quietLogger()))
+			err := s.Connect()
+			if tt.command == command {
+				if err != nil {
+					t.Fatalf("Connect: %v", err)
+				}
+				defer s.Disconnect()
+				if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+			} else if err == nil {
+				s.Disconnect()
+				t.Fatal("Connect succeeded, want the device to refuse the session")
+			}
+			if got := f.SessionRequests(); !slices.Equal(got, tt.wantReqs) {
+				t.Errorf("session requests = %q, want %q", got, tt.wantReqs)
+			}
+		})
+	}
+}
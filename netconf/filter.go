@@ -0,0 +1,270 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// filterPredicate is the bracketed condition of a filter: Func applied to the text of the Field child, or to
+// the target element's own text when Field is "text()".
+type filterPredicate struct {
+	Func  string // start-with, contains, ends-with or equals
+	Field string
+	Value string
+}
+
+var predicateFuncs = []string{"start-with", "starts-with", "contains", "ends-with"}
+
+func (p filterPredicate) matches(text string) bool {
+	text = strings.TrimSpace(text)
+	switch p.Func {
+	case "start-with":
+		return strings.HasPrefix(text, p.Value)
+	case "contains":
+		return strings.Contains(text, p.Value)
+	case "ends-with":
+		return strings.HasSuffix(text, p.Value)
+	default:
+		return text == p.Value
+	}
+}
+
+func parseXPathFilter(filter string) (predicate filterPredicate, path []string, err error) {
+
+	filter = strings.Trim(filter, "/ ")
+	startIdx := strings.Index(filter, "[")
+	if startIdx == -1 {
+		return predicate, nil, fmt.Errorf("no predicate found in filter")
+	}
+
+	pathStr := filter[:startIdx]
+	predicateStr := filter[startIdx:]
+	path = strings.Split(pathStr, "/")
+	if len(path) == 0 {
+		return predicate, nil, fmt.Errorf("empty path")
+	}
+
+	predicateStr = strings.TrimSpace(strings.Trim(predicateStr, "[]"))
+	unquote := func(v string) string {
+		return strings.Trim(strings.TrimSpace(v), "'\"")
+	}
+
+	if open := strings.Index(predicateStr, "("); open > 0 && strings.HasSuffix(predicateStr, ")") && !strings.HasPrefix(predicateStr, "text()") {
+		name := strings.TrimSpace(predicateStr[:open])
+		known := false
+		for _, fn := range predicateFuncs {
+			if name == fn {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return predicate, nil, fmt.Errorf("unsupported predicate function %q; use %s or field='value'", name, strings.Join(predicateFuncs, ", "))
+		}
+		args := strings.SplitN(predicateStr[open+1:len(predicateStr)-1], ",", 2)
+		if len(args) != 2 {
+			return predicate, nil, fmt.Errorf("invalid %s predicate: %s", name, predicateStr)
+		}
+		if name == "starts-with" {
+			name = "start-with"
+		}
+		return filterPredicate{Func: name, Field: strings.TrimSpace(args[0]), Value: unquote(args[1])}, path, nil
+	}
+
+	if field, value, found := strings.Cut(predicateStr, "="); found {
+		return filterPredicate{Func: "equals", Field: strings.TrimSpace(field), Value: unquote(value)}, path, nil
+	}
+
+	return predicate, nil, fmt.Errorf("unsupported predicate [%s]; use %s or field='value'", predicateStr, strings.Join(predicateFuncs, ", "))
+}
+
+// ancestorPathMatches reports whether the open elements match the filter's ancestor path.
+// The path may be absolute from rpc-reply or relative to the rpc-reply/data content.
+func ancestorPathMatches(stack []xml.StartElement, ancestors []string) bool {
+	equal := func(a []xml.StartElement, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !nameMatches(a[i].Name, b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if equal(stack, ancestors) {
+		return true
+	}
+	if len(stack) >= 2 && stack[0].Name.Local == "rpc-reply" && stack[1].Name.Local == "data" {
+		return equal(stack[2:], ancestors)
+	}
+	return false
+}
+
+// nameMatches compares a raw element name to a filter path step, which may be written with or without the prefix.
+func nameMatches(n xml.Name, step string) bool {
+	return step == n.Local || (n.Space != "" && step == n.Space+":"+n.Local)
+}
+
+func stackPath(stack []xml.StartElement) string {
+	var b strings.Builder
+	for _, se := range stack {
+		b.WriteString("/")
+		b.WriteString(rawName(se.Name).Local)
+	}
+	return b.String()
+}
+
+// FilterOptions tune how Filter treats the ancestor path of the filter expression.
+type FilterOptions struct {
+	// Strict fails the filter when the ancestor path does not match the reply.
+	Strict bool
+	// KeepAncestors drops everything except the matched blocks and the ancestor chain leading to them.
+	KeepAncestors bool
+	// Logger receives a warning when the ancestor path does not match and Strict is off; nil drops it.
+	Logger *slog.Logger
+}
+
+// Filter keeps the elements of xmlData addressed by an XPath-like filter such as
+// /rpc-reply/data/terminal-device/logical-channels/channel[start-with(index,'10115')]. The predicate may also
+// use contains, ends-with, field='value' or text()='value'.
+func Filter(xmlData, filter string, opts FilterOptions) (string, error) {
+
+	// filter := "/rpc-reply/data/terminal-device/logical-channels/channel[start-with(index,'10115')]"
+
+	predicate, path, err := parseXPathFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	targetElement := path[len(path)-1]
+	ancestors := path[:len(path)-1]
+	warned := false
+	ownText := predicate.Field == "text()"
+	inField := false
+	var fieldText strings.Builder
+	var output bytes.Buffer
+	var currentChannel bytes.Buffer
+	inChannel := false
+	keepChannel := false
+	depth := 0
+	stack := []xml.StartElement{}
+	opened := []bool{}
+
+	decoder := xml.NewDecoder(strings.NewReader(xmlData))
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	for {
+		// raw tokens keep prefixes and xmlns attributes as written, so the output stays bound to the same namespaces
+		token, err := decoder.RawToken()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if nameMatches(t.Name, targetElement) && !inChannel {
+				if !ancestorPathMatches(stack, ancestors) {
+					if opts.Strict {
+						return "", fmt.Errorf("filter path /%s does not match the reply: <%s> found under %s", strings.Join(path, "/"), targetElement, stackPath(stack))
+					}
+					if !warned && opts.Logger != nil {
+						opts.Logger.Warn("filter path does not match the reply", "filter", "/"+strings.Join(path, "/"), "element", targetElement, "found-under", stackPath(stack))
+					}
+					warned = true
+				}
+				inChannel = true
+				depth = 1
+				currentChannel.Reset()
+				fieldText.Reset()
+				currentChannel.WriteString(xmlMarshalStartElement(t))
+			} else if inChannel {
+				depth++
+				currentChannel.WriteString(xmlMarshalStartElement(t))
+				if !ownText && nameMatches(t.Name, predicate.Field) {
+					inField = true
+					fieldText.Reset()
+				}
+			} else {
+				open := !opts.KeepAncestors || len(stack) == 0
+				if open {
+					output.WriteString(xmlMarshalStartElement(t))
+				}
+				stack = append(stack, t)
+				opened = append(opened, open)
+			}
+
+		case xml.EndElement:
+			if inChannel {
+				if inField && predicate.matches(fieldText.String()) {
+					keepChannel = true
+				}
+				inField = false
+				if ownText && depth == 1 && predicate.matches(fieldText.String()) {
+					keepChannel = true
+				}
+				currentChannel.WriteString(fmt.Sprintf("</%s>", rawName(t.Name).Local))
+				depth--
+				if depth == 0 {
+					inChannel = false
+					if keepChannel {
+						for i := range stack {
+							if !opened[i] {
+								output.WriteString(xmlMarshalStartElement(stack[i]))
+								output.WriteString("\n")
+								opened[i] = true
+							}
+						}
+						output.Write(currentChannel.Bytes())
+						output.WriteString("\n")
+					}
+					keepChannel = false
+				}
+			} else {
+				if len(stack) > 0 {
+					if opened[len(opened)-1] {
+						output.WriteString(fmt.Sprintf("</%s>\n", rawName(t.Name).Local))
+					}
+					stack = stack[:len(stack)-1]
+					opened = opened[:len(opened)-1]
+				}
+			}
+
+		case xml.CharData:
+			if inChannel {
+				if inField || (ownText && depth == 1) {
+					fieldText.Write(t)
+				}
+				currentChannel.WriteString(escapeText(string(t)))
+			} else if !opts.KeepAncestors {
+				output.WriteString(escapeText(string(t)))
+			}
+		}
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		if opened[i] {
+			output.WriteString(fmt.Sprintf("</%s>\n", rawName(stack[i].Name).Local))
+		}
+	}
+
+	return FormatXML(output.String()), nil
+
+}
+
+// xmlMarshalStartElement writes a raw start tag, prefixes included, with its attribute values escaped,
+// so quotes, ampersands and angle brackets in them can't break the filtered output.
+func xmlMarshalStartElement(se xml.StartElement) string {
+	var b strings.Builder
+	b.WriteString("<" + rawName(se.Name).Local)
+	for _, attr := range se.Attr {
+		fmt.Fprintf(&b, ` %s="%s"`, rawName(attr.Name).Local, escapeText(attr.Value))
+	}
+	b.WriteString(">")
+	return b.String()
+}
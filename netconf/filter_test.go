@@ -0,0 +1,211 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const channelsReply = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>` +
+	`<terminal-device><logical-channels>` +
+	`<channel><index>10115</index><name>och-1</name></channel>` +
+	`<channel><index>20001</index><name>och-2</name></channel>` +
+	`</logical-channels></terminal-device></data></rpc-reply>`
+
+func TestFilterAncestorPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		wantWarn bool
+	}{
+		{"absolute path", "/rpc-reply/data/terminal-device/logical-channels/channel[start-with(index,'101')]", false},
+		{"path relative to data", "/terminal-device/logical-channels/channel[start-with(index,'101')]", false},
+		{"wrong root", "/wrong/root/channel[start-with(index,'101')]", true},
+		{"missing level", "/terminal-device/channel[start-with(index,'101')]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			got, err := Filter(channelsReply, tt.filter, FilterOptions{Logger: slog.New(slog.NewTextHandler(&logs, nil))})
+			if err != nil {
+				t.Fatalf("Filter: %v", err)
+			}
+			if !strings.Contains(got, "och-1") || strings.Contains(got, "och-2") {
+				t.Errorf("Filter output = %q, want only channel och-1", got)
+			}
+			if warned := strings.Contains(logs.String(), "filter path does not match the reply"); warned != tt.wantWarn {
+				t.Errorf("warning logged = %v, want %v; log: %q", warned, tt.wantWarn, logs.String())
+			}
+			if tt.wantWarn && strings.Count(logs.String(), "\n") != 1 {
+				t.Errorf("want a single warning per filter, got %q", logs.String())
+			}
+
+			_, err = Filter(channelsReply, tt.filter, FilterOptions{Strict: true})
+			if tt.wantWarn {
+				if err == nil || !strings.Contains(err.Error(), "found under /rpc-reply/data/terminal-device/logical-channels") {
+					t.Errorf("strict Filter error = %v, want the path mismatch", err)
+				}
+			} else if err != nil {
+				t.Errorf("strict Filter: %v", err)
+			}
+		})
+	}
+}
+
+// TestFilterPredicateFields matches predicates against child elements other than index, a field nested below
+// the target, and a target nested in another target, which is kept once as part of the outer block.
+func TestFilterPredicateFields(t *testing.T) {
+	const interfaces = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><interfaces>` +
+		`<interface><name>eth0</name><description>uplink to core</description></interface>` +
+		`<interface><name>eth1</name><description>access port</description></interface>` +
+		`<interface><name>lo0</name><description>loopback</description></interface>` +
+		`</interfaces></data></rpc-reply>`
+	const nestedField = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><channels>` +
+		`<channel><index>1</index><config><settings><mode>coherent</mode></settings></config></channel>` +
+		`<channel><index>2</index><config><settings><mode>direct</mode></settings></config></channel>` +
+		`</channels></data></rpc-reply>`
+	const nestedTarget = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><channels>` +
+		`<channel><name>och-1</name><channel><name>och-1.1</name></channel></channel>` +
+		`<channel><name>och-2</name></channel>` +
+		`</channels></data></rpc-reply>`
+	tests := []struct {
+		name        string
+		reply       string
+		filter      string
+		wantKept    []string
+		wantDropped []string
+	}{
+		{"start-with on name", interfaces, "/interfaces/interface[start-with(name,'eth')]",
+			[]string{"<name>eth0</name>", "<name>eth1</name>"}, []string{"lo0"}},
+		{"contains on description", interfaces, "/interfaces/interface[contains(description,'port')]",
+			[]string{"<name>eth1</name>"}, []string{"eth0", "lo0"}},
+		{"ends-with on description", interfaces, "/interfaces/interface[ends-with(description,'core')]",
+			[]string{"<name>eth0</name>"}, []string{"eth1", "lo0"}},
+		{"equals on name", interfaces, "/interfaces/interface[name='lo0']",
+			[]string{"<description>loopback</description>"}, []string{"eth0", "eth1"}},
+		{"field nested in the target", nestedField, "/channels/channel[mode='coherent']",
+			[]string{"<index>1</index>", "<mode>coherent</mode>"}, []string{"<index>2</index>", "direct"}},
+		{"target nested in a target", nestedTarget, "/channels/channel[ends-with(name,'.1')]",
+			[]string{"<name>och-1</name>", "<name>och-1.1</name>"}, []string{"och-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Filter(tt.reply, tt.filter, FilterOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("Filter: %v", err)
+			}
+			for _, want := range tt.wantKept {
+				if strings.Count(got, want) != 1 {
+					t.Errorf("Filter output = %q, want %q once", got, want)
+				}
+			}
+			for _, unwanted := range tt.wantDropped {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("Filter output = %q, want no %q", got, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterEscapesAttributes(t *testing.T) {
+	const reply = `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><channels>` +
+		`<channel description="a &amp; &quot;b&quot; &lt;c&gt;"><index>10115</index><name>R&amp;D &lt;lab&gt;</name></channel>` +
+		`</channels></data></rpc-reply>`
+	got, err := Filter(reply, "/channels/channel[index='10115']", FilterOptions{})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+
+	var parsed struct {
+		Data struct {
+			Channels struct {
+				Channel struct {
+					Description string `xml:"description,attr"`
+					Index       string `xml:"index"`
+					Name        string `xml:"name"`
+				} `xml:"channel"`
+			} `xml:"channels"`
+		} `xml:"data"`
+	}
+	if err := xml.Unmarshal([]byte(got), &parsed); err != nil {
+		t.Fatalf("filtered output does not parse: %v\n%s", err, got)
+	}
+	channel := parsed.Data.Channels.Channel
+	if channel.Description != `a & "b" <c>` || channel.Index != "10115" || channel.Name != "R&D <lab>" {
+		t.Errorf("round-tripped channel = %+v", channel)
+	}
+}
+
+// TestFilterKeepAncestors re-parses KeepAncestors output and checks it is a single document rooted like the
+// reply, holding the matched channel under its original ancestors and none of the unrelated siblings.
+func TestFilterKeepAncestors(t *testing.T) {
+	const reply = `<rpc-reply message-id="7" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>` +
+		`<system xmlns="urn:example:system"><hostname>rtr-a</hostname></system>` +
+		`<terminal-device xmlns="urn:example:td"><config><mode>fixed</mode></config><logical-channels>` +
+		`<channel><index>10115</index><name>och-1</name></channel>` +
+		`<channel><index>20001</index><name>och-2</name></channel>` +
+		`</logical-channels></terminal-device></data></rpc-reply>`
+	got, err := Filter(reply, "/terminal-device/logical-channels/channel[index='10115']", FilterOptions{KeepAncestors: true})
+	if err != nil {
+		t.Fatalf("Filter: %v", err)
+	}
+
+	var paths []string
+	var stack []string
+	roots := 0
+	d := xml.NewDecoder(strings.NewReader(got))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("filtered output does not re-parse: %v\n%s", err, got)
+		}
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				roots++
+				if el.Name.Space != "urn:ietf:params:xml:ns:netconf:base:1.0" || attrValue(el, "message-id") != "7" {
+					t.Errorf("root = %+v, want the rpc-reply with its namespace and message-id", el)
+				}
+			}
+			stack = append(stack, el.Name.Local)
+			paths = append(paths, "/"+strings.Join(stack, "/"))
+			if el.Name.Local == "terminal-device" && el.Name.Space != "urn:example:td" {
+				t.Errorf("terminal-device namespace = %q, want urn:example:td", el.Name.Space)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	want := []string{
+		"/rpc-reply",
+		"/rpc-reply/data",
+		"/rpc-reply/data/terminal-device",
+		"/rpc-reply/data/terminal-device/logical-channels",
+		"/rpc-reply/data/terminal-device/logical-channels/channel",
+		"/rpc-reply/data/terminal-device/logical-channels/channel/index",
+		"/rpc-reply/data/terminal-device/logical-channels/channel/name",
+	}
+	if roots != 1 || !slices.Equal(paths, want) {
+		t.Errorf("filtered output elements = %q in %d documents, want %q in one\n%s", paths, roots, want, got)
+	}
+	if !strings.Contains(got, "<name>och-1</name>") {
+		t.Errorf("filtered output = %q, want channel och-1", got)
+	}
+}
+
+func attrValue(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
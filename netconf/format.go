@@ -0,0 +1,152 @@
+package netconf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// declEncoding matches the encoding pseudo-attribute of an XML declaration.
+var declEncoding = regexp.MustCompile(`(\bencoding\s*=\s*)("[^"]*"|'[^']*')`)
+
+// FormatXML pretty-prints an XML document or fragment with two-space indentation. A trailing ]]>]]> delimiter
+// is kept on its own line, and input that doesn't parse is only stripped of blank lines. CDATA sections are kept
+// as written in UTF-8 input; in input of another encoding they come out as escaped text, which means the same,
+// and the XML declaration is rewritten to say UTF-8, which is what the output is.
+func FormatXML(data string) string {
+	return FormatXMLIndent(data, "  ")
+}
+
+// FormatXMLIndent is FormatXML with a custom indent string; an empty indent emits compact single-line XML.
+func FormatXMLIndent(data, indent string) string {
+	body, trailer := data, ""
+	if idx := strings.LastIndex(data, "]]>]]>"); idx != -1 {
+		body, trailer = data[:idx], strings.TrimSpace(data[idx:])
+	}
+
+	formatted, err := indentXML(body, indent)
+	if err != nil {
+		return removeBlankLines(data)
+	}
+	if trailer != "" && indent != "" {
+		formatted += "\n"
+	}
+	return formatted + trailer
+}
+
+// indentXML re-encodes the token stream with the given indent. Tokens are read raw so namespace prefixes and
+// xmlns declarations come out exactly as they went in, and whitespace-only text between elements is dropped.
+func indentXML(data, indent string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(data))
+	// once the input is transcoded, decoder offsets no longer index data
+	transcoded := false
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		transcoded = true
+		return charset.NewReaderLabel(label, input)
+	}
+
+	var b strings.Builder
+	encoder := xml.NewEncoder(&b)
+	encoder.Indent("", indent)
+
+	// The encoder doesn't indent comments, processing instructions or directives, so they're written
+	// directly, on their own line at the current depth.
+	depth := 0
+	started := false
+	writeRaw := func(s string) error {
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		if b.Len() > 0 && indent != "" {
+			b.WriteString("\n" + strings.Repeat(indent, depth))
+		}
+		b.WriteString(s)
+		return nil
+	}
+
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := encoder.Flush(); err != nil {
+				return "", err
+			}
+			if !started && b.Len() > 0 && indent != "" {
+				b.WriteString("\n")
+			}
+			started = true
+			depth++
+			start := xml.StartElement{Name: rawName(t.Name), Attr: make([]xml.Attr, len(t.Attr))}
+			for i, attr := range t.Attr {
+				start.Attr[i] = xml.Attr{Name: rawName(attr.Name), Value: attr.Value}
+			}
+			err = encoder.EncodeToken(start)
+		case xml.EndElement:
+			depth--
+			err = encoder.EncodeToken(xml.EndElement{Name: rawName(t.Name)})
+		case xml.CharData:
+			if !transcoded && strings.HasPrefix(data[offset:], "<![CDATA[") {
+				// the encoder would escape it, write the section as it was; it stays inline like any text
+				if err = encoder.Flush(); err == nil {
+					b.WriteString("<![CDATA[" + string(t) + "]]>")
+				}
+				break
+			}
+			if len(bytes.TrimSpace(t)) == 0 {
+				continue
+			}
+			err = encoder.EncodeToken(t)
+		case xml.Comment:
+			err = writeRaw("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			inst := string(t.Inst)
+			if t.Target == "xml" && transcoded {
+				// the output is UTF-8 now, whatever the input was
+				inst = declEncoding.ReplaceAllString(inst, `${1}"UTF-8"`)
+			}
+			err = writeRaw("<?" + t.Target + " " + inst + "?>")
+		case xml.Directive:
+			err = writeRaw("<!" + string(t) + ">")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// rawName folds a raw token's prefix back into the local name, so the encoder writes it verbatim.
+func rawName(n xml.Name) xml.Name {
+	if n.Space == "" {
+		return n
+	}
+	return xml.Name{Local: n.Space + ":" + n.Local}
+}
+
+func removeBlankLines(data string) string {
+	lines := strings.Split(data, "\n")
+	var result []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			result = append(result, line)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,54 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFormatXMLGolden formats each testdata/format/*.xml and compares it with the .golden file next to it.
+func TestFormatXMLGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "format", "*.xml"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("no golden inputs: %v", err)
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".xml")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(input, ".xml") + ".golden")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := FormatXML(string(data)); got != strings.TrimSuffix(string(want), "\n") {
+				t.Errorf("FormatXML(%s) =\n%s\nwant\n%s", input, got, want)
+			}
+		})
+	}
+}
+
+func TestFormatXMLTranscodedCDATA(t *testing.T) {
+	// outside UTF-8 a CDATA section is normalised to escaped text with the same meaning
+	input := `<?xml version="1.0" encoding="ISO-8859-1"?><a><![CDATA[x < y]]></a>`
+	if got, want := FormatXMLIndent(input, ""), `<?xml version="1.0" encoding="UTF-8"?><a>x &lt; y</a>`; got != want {
+		t.Errorf("FormatXMLIndent = %q, want %q", got, want)
+	}
+}
+
+// TestFormatXMLTranscodedDeclaration formats a Latin-1 reply and checks the output, now UTF-8, no longer
+// declares the input's encoding.
+func TestFormatXMLTranscodedDeclaration(t *testing.T) {
+	input := "<?xml version='1.0' encoding='ISO-8859-1'?><rpc-reply><data><descr>Z\xfcrich</descr></data></rpc-reply>"
+	want := "<?xml version='1.0' encoding=\"UTF-8\"?>\n<rpc-reply>\n  <data>\n    <descr>Zürich</descr>\n  </data>\n</rpc-reply>"
+	if got := FormatXML(input); got != want {
+		t.Errorf("FormatXML = %q, want %q", got, want)
+	}
+	if err := xml.NewDecoder(strings.NewReader(FormatXML(input))).Decode(new(struct{ XMLName xml.Name })); err != nil {
+		t.Errorf("formatted output does not parse as declared: %v", err)
+	}
+}
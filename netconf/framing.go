@@ -0,0 +1,137 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	baseCapability10 = "urn:ietf:params:netconf:base:1.0"
+	baseCapability11 = "urn:ietf:params:netconf:base:1.1"
+
+	// maxChunkSize is the largest chunk-size allowed by RFC 6242.
+	maxChunkSize = 4294967295
+)
+
+// eomDelimiter ends every message under 1.0 framing.
+var eomDelimiter = []byte("]]>]]>")
+
+// delimiterIndex returns the position of the first ]]>]]> in data, or -1. Everything before from was already
+// scanned, so only the new bytes plus len(eomDelimiter)-1 bytes of overlap are searched, which catches a
+// delimiter split across two reads without rescanning a large reply on every read.
+func delimiterIndex(data []byte, from int) int {
+	start := max(from-(len(eomDelimiter)-1), 0)
+	if i := bytes.Index(data[start:], eomDelimiter); i >= 0 {
+		return start + i
+	}
+	return -1
+}
+
+// writeChunk writes payload as a single RFC 6242 chunk.
+func writeChunk(w io.Writer, payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "\n#%d\n", len(payload)); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// writeEndOfChunks terminates a chunked message.
+func writeEndOfChunks(w io.Writer) error {
+	_, err := io.WriteString(w, "\n##\n")
+	return err
+}
+
+// readChunkedMessage reads one RFC 6242 chunked message and returns the reassembled payload.
+func readChunkedMessage(r *bufio.Reader) (string, error) {
+	var payload bytes.Buffer
+	if _, err := copyChunkedMessage(r, &payload); err != nil {
+		return "", err
+	}
+	return payload.String(), nil
+}
+
+// copyChunkedMessage copies the payload of one RFC 6242 chunked message to w as each chunk arrives. A stream
+// ending before the end-of-chunks marker is an io.ErrUnexpectedEOF, unless it ends before the message starts.
+func copyChunkedMessage(r *bufio.Reader, w io.Writer) (int64, error) {
+	var written int64
+	for first := true; ; first = false {
+		if err := expectByte(r, '\n'); err != nil {
+			if err == io.EOF && first {
+				return 0, ErrChannelClosed
+			}
+			return written, cutOff(err, written)
+		}
+		if err := expectByte(r, '#'); err != nil {
+			return written, cutOff(err, written)
+		}
+
+		c, err := r.ReadByte()
+		if err != nil {
+			return written, fmt.Errorf("malformed chunk header: %v", err)
+		}
+		if c == '#' {
+			if err := expectByte(r, '\n'); err != nil {
+				return written, err
+			}
+			return written, nil
+		}
+		if c < '1' || c > '9' {
+			return written, fmt.Errorf("malformed chunk header: unexpected %q in chunk size", c)
+		}
+
+		digits := []byte{c}
+		for {
+			c, err = r.ReadByte()
+			if err != nil {
+				return written, fmt.Errorf("malformed chunk header: %v", err)
+			}
+			if c == '\n' {
+				break
+			}
+			if c < '0' || c > '9' || len(digits) >= 10 {
+				return written, fmt.Errorf("malformed chunk header: invalid chunk size %q", string(append(digits, c)))
+			}
+			digits = append(digits, c)
+		}
+
+		size, err := strconv.ParseUint(string(digits), 10, 64)
+		if err != nil || size > maxChunkSize {
+			return written, fmt.Errorf("malformed chunk header: invalid chunk size %q", string(digits))
+		}
+
+		n, err := io.CopyN(w, r, int64(size))
+		written += n
+		if err != nil {
+			return written, fmt.Errorf("truncated chunk: %w", cutOff(err, written))
+		}
+	}
+}
+
+// cutOff turns an io.EOF in the middle of a chunked message into a wrapped io.ErrUnexpectedEOF.
+func cutOff(err error, written int64) error {
+	if err == io.EOF {
+		return fmt.Errorf("reply cut off after %d bytes: %w", written, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+func expectByte(r *bufio.Reader, want byte) error {
+	c, err := r.ReadByte()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("malformed chunk header: %v", err)
+	}
+	if c != want {
+		return fmt.Errorf("malformed chunk header: expected %q, got %q", want, c)
+	}
+	return nil
+}
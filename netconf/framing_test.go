@@ -0,0 +1,61 @@
+package netconf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDelimiterIndex(t *testing.T) {
+	data := []byte("<ok/>]]>]]><next/>")
+	for from := 0; from <= len(data); from++ {
+		want := 5
+		if from > 5+len(eomDelimiter)-1 {
+			// the delimiter ends before the overlap starts, it counts as already scanned
+			want = -1
+		}
+		if got := delimiterIndex(data, from); got != want {
+			t.Errorf("delimiterIndex(data, %d) = %d, want %d", from, got, want)
+		}
+	}
+}
+
+func TestReadMessageDelimiterAcrossReads(t *testing.T) {
+	// place the delimiter across the boundary of the 1024-byte reads at every offset
+	for split := 1; split < len(eomDelimiter); split++ {
+		reply := strings.Repeat("x", 1024-split)
+		s := &Endpoint{SshOut: bytes.NewReader([]byte(reply + "]]>]]>"))}
+		got, err := s.readMessage()
+		if err != nil || got != reply {
+			t.Errorf("split %d: readMessage = %d bytes, %v; want %d bytes", split, len(got), err, len(reply))
+		}
+	}
+
+	s := &Endpoint{SshOut: iotest.OneByteReader(strings.NewReader("<ok/>]]>]]>"))}
+	if got, err := s.readMessage(); err != nil || got != "<ok/>" {
+		t.Errorf("one byte at a time: readMessage = %q, %v", got, err)
+	}
+}
+
+// BenchmarkReadMessage reads an 8 MB base:1.0 reply, which takes over 8000 reads into readMessage's buffer.
+func BenchmarkReadMessage(b *testing.B) {
+	var reply bytes.Buffer
+	reply.WriteString(`<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>`)
+	for i := 0; reply.Len() < 8<<20; i++ {
+		reply.WriteString(`<interface><name>eth`)
+		reply.WriteString(strings.Repeat("0", i%7))
+		reply.WriteString(`</name><mtu>1500</mtu></interface>`)
+	}
+	reply.WriteString(`</data></rpc-reply>]]>]]>`)
+	data := reply.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := &Endpoint{SshOut: bytes.NewReader(data)}
+		if _, err := s.readMessage(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Hello is the decoded server <hello> message.
+type Hello struct {
+	XMLName      xml.Name `xml:"hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id"`
+}
+
+// helloStart matches the start of the server hello, to find it behind a banner or prompt printed ahead of it.
+var helloStart = regexp.MustCompile(`<\?xml|<(?:[\w.-]+:)?hello[\s>]`)
+
+// splitBanner splits raw into any text a device printed before the hello, as some do on a pty session, and the
+// hello itself. raw comes back whole as the hello when no hello start is found.
+func splitBanner(raw string) (banner, hello string) {
+	loc := helloStart.FindStringIndex(raw)
+	if loc == nil {
+		return "", raw
+	}
+	return raw[:loc[0]], raw[loc[0]:]
+}
+
+// ParseHello decodes the server hello, ignoring the end-of-message delimiter.
+func ParseHello(raw string) (*Hello, error) {
+	raw = strings.TrimSpace(raw)
+	if idx := strings.Index(raw, "]]>]]>"); idx != -1 {
+		raw = raw[:idx]
+	}
+	if raw == "" {
+		return nil, fmt.Errorf("server hello is empty")
+	}
+
+	var hello Hello
+	if err := xml.Unmarshal([]byte(raw), &hello); err != nil {
+		return nil, fmt.Errorf("server hello is not a valid <hello> message: %v", err)
+	}
+	return &hello, nil
+}
+
+// validateHello checks the server hello carries a base capability and a session-id.
+func validateHello(raw string) error {
+	hello, err := ParseHello(raw)
+	if err != nil {
+		return err
+	}
+
+	hasBase := false
+	for _, c := range hello.Capabilities {
+		if strings.HasPrefix(strings.TrimSpace(c), "urn:ietf:params:netconf:base:") {
+			hasBase = true
+			break
+		}
+	}
+	if !hasBase {
+		return fmt.Errorf("server hello does not advertise a urn:ietf:params:netconf:base capability")
+	}
+	if strings.TrimSpace(hello.SessionID) == "" {
+		return fmt.Errorf("server hello does not contain a session-id")
+	}
+	return nil
+}
+
+// maxMessageSizeParams are capability query parameters some vendors use to advertise a message size limit in bytes.
+var maxMessageSizeParams = []string{"max-message-size", "max-rpc-size", "max-msg-size"}
+
+// maxMessageSize returns the largest message size advertised in the hello capabilities, or 0 if none is advertised.
+func maxMessageSize(raw string) int {
+	hello, err := ParseHello(raw)
+	if err != nil {
+		return 0
+	}
+
+	largest := 0
+	for _, c := range hello.Capabilities {
+		u, err := url.Parse(strings.TrimSpace(c))
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		for _, param := range maxMessageSizeParams {
+			if n, err := strconv.Atoi(query.Get(param)); err == nil && n > largest {
+				largest = n
+			}
+		}
+	}
+	return largest
+}
@@ -0,0 +1,211 @@
+package netconf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+func TestValidateHello(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr string
+	}{
+		{"valid", netconftest.NewDevice().Hello() + "]]>]]>", ""},
+		{"empty", "", "server hello is empty"},
+		{"only the delimiter", "]]>]]>", "server hello is empty"},
+		{"malformed", `<hello><capabilities><capability>urn:ietf:params:netconf:base:1.0</capabilities>`, "not a valid <hello> message"},
+		{"wrong element", `<rpc-reply><ok/></rpc-reply>`, "not a valid <hello> message"},
+		{"no base capability", testHelloPrefix + `<capability>urn:ietf:params:netconf:capability:candidate:1.0</capability>` +
+			`</capabilities><session-id>1</session-id></hello>`, "does not advertise a urn:ietf:params:netconf:base capability"},
+		{"no session-id", testHelloPrefix + `<capability>urn:ietf:params:netconf:base:1.0</capability></capabilities></hello>`,
+			"does not contain a session-id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHello(tt.raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateHello: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateHello error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStrictHelloRejectsHelloWithoutSessionID(t *testing.T) {
+	f := netconftest.NewDevice(baseCapability10)
+	f.SessionID = ""
+
+	lenient := connectFake(t, f)
+	if lenient.SessionID() != 0 {
+		t.Errorf("SessionID() = %d, want 0 for a hello without one", lenient.SessionID())
+	}
+
+	s := NewEndpoint("127.0.0.1", WithDialer(f.Dial), WithLogger(quietLogger()), WithStrictHello())
+	if err := s.Connect(); err == nil || !strings.Contains(err.Error(), "session-id") {
+		s.Disconnect()
+		t.Fatalf("Connect with StrictHello error = %v, want a missing session-id error", err)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	hello := func(caps ...string) string {
+		d := netconftest.NewDevice(append([]string{baseCapability10}, caps...)...)
+		return d.Hello() + "]]>]]>"
+	}
+	tests := []struct {
+		name  string
+		hello string
+		want  int
+	}{
+		{"no limit advertised", hello("urn:ietf:params:netconf:capability:candidate:1.0"), 0},
+		{"one size hint", hello("http://example.com/netconf/limits?max-message-size=65536"), 65536},
+		{"largest of several", hello("urn:vendor:limits?max-rpc-size=1024", "urn:vendor:other?max-msg-size=4096&amp;foo=bar"), 4096},
+		{"invalid values ignored", hello("urn:vendor:limits?max-message-size=big", "urn:vendor:x?max-rpc-size=-5"), 0},
+		{"unparseable hello", "not xml", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxMessageSize(tt.hello); got != tt.want {
+				t.Errorf("maxMessageSize = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxHelloBytes(t *testing.T) {
+	caps := []string{baseCapability10}
+	for i := 0; i < 100; i++ {
+		caps = append(caps, fmt.Sprintf("urn:example:yang:module-%03d?module=module-%03d&amp;revision=2024-01-01", i, i))
+	}
+	f := netconftest.NewDevice(caps...)
+	if len(f.Hello()) <= 4096 {
+		t.Fatalf("test hello is only %d bytes", len(f.Hello()))
+	}
+
+	s := NewEndpoint("127.0.0.1", WithDialer(f.Dial), WithLogger(quietLogger()), WithMaxHelloBytes(4096))
+	if err := s.Connect(); err == nil || !strings.Contains(err.Error(), "server hello exceeded 4096 bytes") {
+		s.Disconnect()
+		t.Fatalf("Connect error = %v, want the hello size limit", err)
+	}
+
+	// the same hello fits the default limit
+	if s := connectFake(t, f); len(s.ParsedCapabilities) != len(caps) {
+		t.Errorf("parsed %d capabilities, want %d", len(s.ParsedCapabilities), len(caps))
+	}
+}
+
+// bufferCloser is an in-memory SshIn.
+type bufferCloser struct{ bytes.Buffer }
+
+func (*bufferCloser) Close() error { return nil }
+
+// TestHelloAfterBanner feeds exchangeHello a server hello behind the banner and prompt a pty session can print
+// first, and checks the hello is still found and parsed, and only our hello was written.
+func TestHelloAfterBanner(t *testing.T) {
+	hello := netconftest.NewDevice(baseCapability10, baseCapability11).Hello()
+	tests := []struct {
+		name   string
+		banner string
+		hello  string
+	}{
+		{"none", "", hello},
+		{"whitespace", "\r\n", hello},
+		{"banner and prompt", "\r\nUnauthorized access is prohibited <by policy>.\r\nrouter> ", hello},
+		{"xml declaration", "Welcome\r\n", `<?xml version="1.0" encoding="UTF-8"?>` + hello},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var in bufferCloser
+			s := &Endpoint{Ip: "192.0.2.1", Port: "830", SshIn: &in, SshOut: strings.NewReader(tt.banner + tt.hello + "]]>]]>"),
+				StrictHello: true, Logger: quietLogger()}
+			if err := s.exchangeHello(); err != nil {
+				t.Fatalf("exchangeHello: %v", err)
+			}
+			if strings.TrimSpace(s.Capabilities) != tt.hello {
+				t.Errorf("Capabilities = %q, want the hello %q", s.Capabilities, tt.hello)
+			}
+			if s.SessionID() != 42 || s.FramingVersion != "1.1" {
+				t.Errorf("session-id %d, framing %s; want 42 and 1.1", s.SessionID(), s.FramingVersion)
+			}
+			if sent := in.String(); strings.Count(sent, "<hello") != 1 || !strings.HasSuffix(sent, "]]>]]>") {
+				t.Errorf("wrote %q, want one framed client hello", sent)
+			}
+		})
+	}
+}
+
+func TestEndpointSendsOneHello(t *testing.T) {
+	for _, caps := range [][]string{{baseCapability10}, {baseCapability10, baseCapability11}} {
+		f := netconftest.NewDevice(caps...)
+		s := connectFake(t, f)
+		if _, err := s.Run(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`); err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		if hellos := f.Hellos(); hellos != 1 {
+			t.Errorf("caps %v: device received %d hellos, want 1", caps, hellos)
+		}
+		if reqs := f.Requests(); len(reqs) != 1 || !strings.Contains(reqs[0], "<get/>") {
+			t.Errorf("caps %v: first request = %q, want the <get/>", caps, reqs)
+		}
+	}
+}
+
+// TestExchangeHelloWritesOneHello counts the hellos written to an in-memory SshIn across the hello exchange
+// and the first RPC, which must follow the single client hello.
+func TestExchangeHelloWritesOneHello(t *testing.T) {
+	const rpc = `<rpc message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`
+	hello := netconftest.NewDevice(baseCapability10).Hello()
+	var in bufferCloser
+	s := &Endpoint{Ip: "192.0.2.1", Port: "830", SshIn: &in, Logger: quietLogger(),
+		SshOut: strings.NewReader(hello + "]]>]]>" + reply(rpc, okBody) + "]]>]]>")}
+	if err := s.exchangeHello(); err != nil {
+		t.Fatalf("exchangeHello: %v", err)
+	}
+	if s.Capabilities != hello {
+		t.Errorf("Capabilities = %q, want the server hello %q", s.Capabilities, hello)
+	}
+	if _, err := s.Run(rpc); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	written := in.String()
+	if n := strings.Count(written, "<hello"); n != 1 {
+		t.Errorf("wrote %d hellos, want 1: %q", n, written)
+	}
+	if _, after, _ := strings.Cut(written, "</hello>]]>]]>"); !strings.HasPrefix(after, rpc) {
+		t.Errorf("wrote %q after the hello, want the rpc first", after)
+	}
+}
+
+func TestSessionID(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  string
+		wantRemote string
+		want       int
+	}{
+		{"numeric", "4711", "4711", 4711},
+		{"surrounded by whitespace", "\n  4711\n", "4711", 4711},
+		{"not a number", "abc", "abc", 0},
+		{"missing", "", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice()
+			f.SessionID = tt.sessionID
+			s := connectFake(t, f)
+			if s.RemoteSessionID != tt.wantRemote || s.SessionID() != tt.want {
+				t.Errorf("RemoteSessionID %q, SessionID() %d; want %q and %d", s.RemoteSessionID, s.SessionID(), tt.wantRemote, tt.want)
+			}
+		})
+	}
+}
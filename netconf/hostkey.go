@@ -0,0 +1,98 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func defaultKnownHostsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// hostKeyCallback builds the HostKeyCallback for the given policy:
+// strict (the default) rejects unknown or changed keys and a missing known_hosts file, warn prints and proceeds
+// (recording unknown keys, creating the file if needed), ignore accepts anything.
+func hostKeyCallback(policy, knownHostsPath string, logger *slog.Logger) (ssh.HostKeyCallback, error) {
+	if policy == "ignore" {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	if policy == "" {
+		policy = "strict"
+	}
+	if policy != "strict" && policy != "warn" {
+		return nil, fmt.Errorf("unknown host key policy %q; use strict, warn or ignore", policy)
+	}
+
+	if knownHostsPath == "" {
+		knownHostsPath = defaultKnownHostsPath()
+	}
+	if _, err := os.Stat(knownHostsPath); errors.Is(err, os.ErrNotExist) {
+		// strict could only ever reject against an empty file, so leave the filesystem alone and say why
+		if policy == "strict" {
+			return nil, fmt.Errorf("known_hosts file %s does not exist; add the device's host key to it, or use the warn policy to record it on first connect", knownHostsPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create known_hosts directory: %v", err)
+		}
+		if err := os.WriteFile(knownHostsPath, nil, 0600); err != nil {
+			return nil, fmt.Errorf("failed to create known_hosts file %s: %v", knownHostsPath, err)
+		}
+	}
+
+	known, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts file %s: %v", knownHostsPath, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := known(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			if policy == "strict" {
+				return fmt.Errorf("host key for %s has changed (got %s %s); remove the stale entry from %s if this is expected", hostname, key.Type(), fingerprint, knownHostsPath)
+			}
+			logger.Warn("host key has changed, proceeding anyway", "host", hostname, "type", key.Type(), "fingerprint", fingerprint)
+			return nil
+		}
+
+		if policy == "strict" {
+			return fmt.Errorf("host key for %s is unknown (%s %s); add it to %s", hostname, key.Type(), fingerprint, knownHostsPath)
+		}
+		logger.Warn("unknown host key, recording it", "host", hostname, "type", key.Type(), "fingerprint", fingerprint, "known-hosts", knownHostsPath)
+		return appendKnownHost(knownHostsPath, hostname, key)
+	}, nil
+}
+
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("failed to record host key in %s: %v", path, err)
+	}
+	return nil
+}
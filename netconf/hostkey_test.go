@@ -0,0 +1,179 @@
+package netconf
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyPolicies(t *testing.T) {
+	const host = "192.0.2.1:830"
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 830}
+	knownKey, otherKey := newTestHostKey(t), newTestHostKey(t)
+
+	tests := []struct {
+		policy  string
+		store   string // known, unknown or changed: how the presented key relates to the known_hosts entry
+		wantErr string
+	}{
+		{"strict", "known", ""},
+		{"strict", "unknown", "is unknown"},
+		{"strict", "changed", "has changed"},
+		{"warn", "known", ""},
+		{"warn", "unknown", ""},
+		{"warn", "changed", ""},
+		{"ignore", "known", ""},
+		{"ignore", "unknown", ""},
+		{"ignore", "changed", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.store, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "known_hosts")
+			var entries string
+			presented := knownKey
+			switch tt.store {
+			case "known":
+				entries = knownhosts.Line([]string{knownhosts.Normalize(host)}, knownKey) + "\n"
+			case "changed":
+				entries = knownhosts.Line([]string{knownhosts.Normalize(host)}, knownKey) + "\n"
+				presented = otherKey
+			}
+			if err := os.WriteFile(path, []byte(entries), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			cb, err := hostKeyCallback(tt.policy, path, quietLogger())
+			if err != nil {
+				t.Fatalf("hostKeyCallback: %v", err)
+			}
+			err = cb(host, remote, presented)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("callback error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("callback: %v", err)
+			}
+
+			if tt.policy == "warn" && tt.store == "unknown" {
+				strict, err := hostKeyCallback("strict", path, quietLogger())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := strict(host, remote, presented); err != nil {
+					t.Errorf("warn did not record the unknown key: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHostKeyPolicyUnknown(t *testing.T) {
+	if _, err := hostKeyCallback("trust-me", filepath.Join(t.TempDir(), "known_hosts"), quietLogger()); err == nil {
+		t.Fatal("hostKeyCallback accepted an unknown policy")
+	}
+}
+
+// TestHostKeyCallbackOption checks a callback from WithHostKeyCallback gets the device's host key during Connect,
+// takes precedence over a strict policy whose known_hosts would reject it, and can refuse the key.
+func TestHostKeyCallbackOption(t *testing.T) {
+	hostKey, err := netconftest.NewHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+	}
+	config.AddHostKey(hostKey)
+	port := listenSSH(t, netconftest.NewDevice(), config)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, refuse := range []bool{false, true} {
+		var calls int
+		var gotHost string
+		var gotKey ssh.PublicKey
+		cb := func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			calls++
+			gotHost, gotKey = hostname, key
+			if refuse {
+				return errors.New("not in the trust store")
+			}
+			return nil
+		}
+		s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("strict", knownHosts),
+			WithHostKeyCallback(cb), WithTimeout(5), WithLogger(quietLogger()))
+		err := s.Connect()
+		if err == nil {
+			s.Disconnect()
+		}
+		if refuse {
+			if err == nil || !strings.Contains(err.Error(), "not in the trust store") {
+				t.Errorf("Connect with a refusing callback = %v, want its error", err)
+			}
+		} else if err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("refuse %v: callback called %d times, want 1", refuse, calls)
+		}
+		if gotHost != "127.0.0.1:"+port {
+			t.Errorf("refuse %v: callback hostname = %q, want 127.0.0.1:%s", refuse, gotHost, port)
+		}
+		if gotKey == nil || !bytes.Equal(gotKey.Marshal(), hostKey.PublicKey().Marshal()) {
+			t.Errorf("refuse %v: callback was not given the device's host key", refuse)
+		}
+	}
+}
+
+// TestHostKeyPolicyMissingKnownHosts checks strict refuses a missing known_hosts file without creating it, while
+// warn creates it to record keys in.
+func TestHostKeyPolicyMissingKnownHosts(t *testing.T) {
+	for _, policy := range []string{"strict", "", "warn"} {
+		path := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+		_, err := hostKeyCallback(policy, path, quietLogger())
+		_, statErr := os.Stat(path)
+		if policy == "warn" {
+			if err != nil || statErr != nil {
+				t.Errorf("warn: hostKeyCallback error %v, stat error %v; want the file created", err, statErr)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), path+" does not exist") {
+			t.Errorf("policy %q: hostKeyCallback error = %v, want the missing file reported", policy, err)
+		}
+		if !errors.Is(statErr, os.ErrNotExist) {
+			t.Errorf("policy %q: %s was created", policy, path)
+		}
+		if _, err := os.Stat(filepath.Dir(path)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("policy %q: %s was created", policy, filepath.Dir(path))
+		}
+	}
+}
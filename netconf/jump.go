@@ -0,0 +1,65 @@
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// dialJump connects to the bastion in JumpHost and opens a tunnelled TCP connection to addr through it.
+func (s *Endpoint) dialJump(ctx context.Context, addr string, hostKeyCb ssh.HostKeyCallback) (net.Conn, error) {
+	config := &ssh.ClientConfig{
+		User:            s.JumpUsername,
+		HostKeyCallback: hostKeyCb,
+		Timeout:         time.Duration(s.Timeout) * time.Second,
+	}
+	if s.JumpPassword != "" {
+		config.Auth = append(config.Auth, ssh.Password(s.JumpPassword))
+	}
+	if s.JumpKeyPath != "" {
+		auth, err := publicKeyFile(s.JumpKeyPath, "", s.KeyAlgorithms)
+		if err != nil {
+			return nil, fmt.Errorf("jump host %v - %v", s.JumpHost, err)
+		}
+		config.Auth = append(config.Auth, auth)
+	}
+
+	dialer := net.Dialer{Timeout: config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.JumpHost)
+	if err != nil {
+		return nil, fmt.Errorf("jump host %v - %w", s.JumpHost, err)
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.JumpHost, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("jump host %v - %w", s.JumpHost, err)
+	}
+	s.jumpClient = ssh.NewClient(sshConn, chans, reqs)
+
+	tunnel, err := s.jumpClient.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		s.closeJump()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("jump host %v - failed to reach %v: %w", s.JumpHost, addr, err)
+	}
+	return tunnel, nil
+}
+
+func (s *Endpoint) closeJump() {
+	if s.jumpClient != nil {
+		s.jumpClient.Close()
+		s.jumpClient = nil
+	}
+}
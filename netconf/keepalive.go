@@ -0,0 +1,73 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrConnectionLost is returned by Run once a keepalive went unanswered and the connection was torn down.
+var ErrConnectionLost = errors.New("connection lost: the device stopped answering SSH keepalives")
+
+// startKeepalive sends keepalive@openssh.com every KeepaliveInterval seconds until stopKeepalive is called.
+// A keepalive that fails, or gets no reply within the interval, marks the session as lost and closes the client.
+func (s *Endpoint) startKeepalive() {
+	if s.KeepaliveInterval <= 0 {
+		return
+	}
+	interval := time.Duration(s.KeepaliveInterval) * time.Second
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	s.keepaliveStop, s.keepaliveDone = stop, done
+	client := s.Client
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if err := sendKeepalive(client, interval); err != nil {
+				s.logger().Error("connection lost", "error", err)
+				s.lost.Store(true)
+				client.Close()
+				return
+			}
+		}
+	}()
+}
+
+// sendKeepalive waits up to timeout for the reply; any reply, even a refusal, proves the device is alive.
+func sendKeepalive(client *ssh.Client, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		if err != nil {
+			return fmt.Errorf("keepalive failed: %v", err)
+		}
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("no keepalive reply within %v", timeout)
+	}
+}
+
+func (s *Endpoint) stopKeepalive() {
+	if s.keepaliveStop != nil {
+		close(s.keepaliveStop)
+		<-s.keepaliveDone
+		s.keepaliveStop, s.keepaliveDone = nil, nil
+	}
+}
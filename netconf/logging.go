@@ -0,0 +1,15 @@
+package netconf
+
+import (
+	"log/slog"
+	"net"
+)
+
+// logger returns the Endpoint's Logger, or slog.Default() when none is set, tagged with the device address.
+func (s *Endpoint) logger() *slog.Logger {
+	l := s.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With("device", net.JoinHostPort(s.Ip, s.Port))
+}
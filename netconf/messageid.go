@@ -0,0 +1,79 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// ErrMessageIDMismatch is returned by Run when the reply carries a message-id other than the request's, or one
+// already answered. The session is closed, since replies can't be matched to requests from then on.
+var ErrMessageIDMismatch = errors.New("reply message-id does not match the request")
+
+var (
+	rpcStartTag     = regexp.MustCompile(`<((?:[\w.-]+:)?rpc)(\s[^>]*)?>`)
+	messageIDAttr   = regexp.MustCompile(`\smessage-id\s*=\s*["']([^"']*)["']`)
+	replyStartTag   = regexp.MustCompile(`<(?:[\w.-]+:)?rpc-reply(\s[^>]*)?>`)
+	notificationTag = regexp.MustCompile(`^(<\?xml[^>]*\?>)?\s*<(?:[\w.-]+:)?notification[\s>]`)
+)
+
+// tagMessageID gives an <rpc> without a message-id the next id from the session counter, and returns the
+// message along with the id the reply must echo. Messages that aren't an <rpc> come back unchanged with "".
+func (s *Endpoint) tagMessageID(msg string) (string, string) {
+	loc := rpcStartTag.FindStringSubmatchIndex(msg)
+	if loc == nil {
+		return msg, ""
+	}
+	tag := msg[loc[0]:loc[1]]
+	if m := messageIDAttr.FindStringSubmatch(tag); m != nil {
+		return msg, m[1]
+	}
+
+	s.messageID++
+	id := strconv.FormatUint(s.messageID, 10)
+	// insert right after the element name, loc[3] is where the name group ends
+	return msg[:loc[3]] + ` message-id="` + id + `"` + msg[loc[3]:], id
+}
+
+// replyMessageID returns the message-id of an <rpc-reply>, or "" when the reply has none.
+func replyMessageID(reply string) string {
+	tag := replyStartTag.FindString(reply)
+	if m := messageIDAttr.FindStringSubmatch(tag); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// checkReplyID returns an ErrMessageIDMismatch unless reply answers the request sent with message-id id, and
+// records id as answered. A reply without a message-id, or to a request whose id isn't known, is accepted.
+func (s *Endpoint) checkReplyID(reply, id string) error {
+	got := replyMessageID(reply)
+	if id == "" || got == "" {
+		return nil
+	}
+	if got != id {
+		if s.answered[got] {
+			return fmt.Errorf("%v:%v - %w: duplicate reply for message-id %q, already answered, while waiting for %q",
+				s.Ip, s.Port, ErrMessageIDMismatch, got, id)
+		}
+		return fmt.Errorf("%v:%v - %w: got message-id %q, want %q", s.Ip, s.Port, ErrMessageIDMismatch, got, id)
+	}
+	if s.answered == nil {
+		s.answered = make(map[string]bool)
+	}
+	s.answered[id] = true
+	return nil
+}
+
+// isNotification reports whether msg is a <notification> rather than an rpc-reply.
+func isNotification(msg string) bool {
+	return notificationTag.MatchString(msg)
+}
+
+// PrepareRPC returns rpc exactly as Run would send it, with a message-id from the session counter when it has none.
+// It doesn't need a connection, so it can show what would be sent without sending it.
+func (s *Endpoint) PrepareRPC(rpc string) string {
+	rpc, _ = s.tagMessageID(rpc)
+	return rpc
+}
@@ -0,0 +1,76 @@
+package netconf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+const getRPC = `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`
+
+func TestRunRejectsMismatchedMessageID(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  func(rpc string) []string
+		rpcs    []string
+		wantErr string
+	}{
+		{
+			name: "duplicated message-id",
+			handle: func(rpc string) []string {
+				if strings.Contains(rpc, `message-id="1"`) {
+					return []string{reply(rpc, okBody), reply(rpc, okBody)}
+				}
+				return nil
+			},
+			rpcs:    []string{getRPC, getRPC},
+			wantErr: `duplicate reply for message-id "1"`,
+		},
+		{
+			name: "unexpected message-id",
+			handle: func(rpc string) []string {
+				return []string{`<rpc-reply message-id="7" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`}
+			},
+			rpcs:    []string{getRPC},
+			wantErr: `got message-id "7", want "1"`,
+		},
+		{
+			name:   "caller-chosen id reused",
+			handle: nil,
+			rpcs: []string{
+				`<rpc message-id="a" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`,
+				`<rpc message-id="a" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get/></rpc>`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, framing := range [][]string{{baseCapability10}, {baseCapability11}} {
+				f := netconftest.NewDevice(framing...)
+				f.Handle = tt.handle
+				s := connectFake(t, f)
+
+				var err error
+				for _, rpc := range tt.rpcs {
+					if _, err = s.Run(rpc); err != nil {
+						break
+					}
+				}
+				if tt.wantErr == "" {
+					if err != nil {
+						t.Fatalf("framing %v: Run: %v", framing, err)
+					}
+					continue
+				}
+				if !errors.Is(err, ErrMessageIDMismatch) {
+					t.Fatalf("framing %v: Run error = %v, want ErrMessageIDMismatch", framing, err)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("framing %v: Run error = %q, want it to mention %q", framing, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Package netconftest provides an in-memory NETCONF device for tests, reachable through netconf.WithDialer
+// or, for code that only dials real addresses, over TLS on a localhost port.
+package netconftest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Base10 = "urn:ietf:params:netconf:base:1.0"
+	Base11 = "urn:ietf:params:netconf:base:1.1"
+
+	HelloPrefix = `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>`
+	OK          = `<ok/>`
+)
+
+var (
+	eom           = []byte("]]>]]>")
+	rpcStartTag   = regexp.MustCompile(`<(?:[\w.-]+:)?rpc(\s[^>]*)?>`)
+	messageIDAttr = regexp.MustCompile(`\smessage-id\s*=\s*["']([^"']*)["']`)
+)
+
+// Device is a fake NETCONF server. It sends a hello with Capabilities and SessionID, negotiates the framing like
+// a device would, and answers each rpc with the messages Handle returns, <ok/> when Handle is nil or returns nil.
+// A <close-session> is answered with <ok/> and ends the session, unless IgnoreCloseSession is set, in which case
+// it goes unanswered and the session stays open, like a device hanging on the way out.
+//
+// HelloXML, when set, is sent as the server hello in place of the one built from Capabilities and SessionID.
+//
+// CloseAfterHello makes the device drop each session as soon as it has the client hello, like a device that
+// times out a session waiting for its first rpc.
+//
+// CutOff, when set and returning a non-empty string for an rpc, makes the device write that text as-is, without
+// framing, in place of a reply and then drop the session, like a device going away in the middle of a reply.
+type Device struct {
+	Capabilities       []string
+	SessionID          string
+	Handle             func(rpc string) []string
+	HelloXML           string
+	CloseAfterHello    bool
+	CutOff             func(rpc string) string
+	IgnoreCloseSession bool
+
+	// RequirePty and ExecCommand only apply to sessions served with ListenSSH.
+	RequirePty  bool
+	ExecCommand string
+
+	mu          sync.Mutex
+	received    []string
+	hellos      int
+	sessionReqs []string
+}
+
+// NewDevice returns a Device offering caps, base:1.0 and base:1.1 when none are given, with session-id 42.
+func NewDevice(caps ...string) *Device {
+	if len(caps) == 0 {
+		caps = []string{Base10, Base11}
+	}
+	return &Device{Capabilities: caps, SessionID: "42"}
+}
+
+// Reply builds an rpc-reply to rpc carrying body, echoing the rpc's message-id.
+func Reply(rpc, body string) string {
+	id := ""
+	if m := messageIDAttr.FindStringSubmatch(rpcStartTag.FindString(rpc)); m != nil {
+		id = ` message-id="` + m[1] + `"`
+	}
+	return `<rpc-reply` + id + ` xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + body + `</rpc-reply>`
+}
+
+// RPCError builds an error-severity rpc-error with the given error-tag and error-message.
+func RPCError(tag, message string) string {
+	return `<rpc-error><error-type>application</error-type><error-tag>` + tag + `</error-tag>` +
+		`<error-severity>error</error-severity><error-message>` + message + `</error-message></rpc-error>`
+}
+
+// Hello returns the server hello the device sends, without the delimiter.
+func (d *Device) Hello() string {
+	if d.HelloXML != "" {
+		return d.HelloXML
+	}
+	var b strings.Builder
+	b.WriteString(HelloPrefix)
+	for _, c := range d.Capabilities {
+		b.WriteString("<capability>" + c + "</capability>")
+	}
+	b.WriteString("</capabilities>")
+	if d.SessionID != "" {
+		b.WriteString("<session-id>" + d.SessionID + "</session-id>")
+	}
+	b.WriteString("</hello>")
+	return b.String()
+}
+
+// Requests returns the messages received after the client hello, across all sessions.
+func (d *Device) Requests() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.received...)
+}
+
+// Hellos returns how many hellos the device has received, across all sessions.
+func (d *Device) Hellos() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.hellos
+}
+
+// Dial is a netconf.Dialer running one session with the device over an in-memory pipe.
+func (d *Device) Dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+	go d.Serve(server)
+	return client, nil
+}
+
+// ListenTLS serves the device over TLS with a self-signed certificate on addr, e.g. 127.0.0.1:0 for any free
+// localhost port, one session per connection, and returns the port. Clients have to skip certificate
+// verification. Close the listener when done.
+func (d *Device) ListenTLS(addr string) (net.Listener, string, error) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		return nil, "", err
+	}
+	ln, err := tls.Listen("tcp", addr, &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		return nil, "", err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.Serve(conn)
+		}
+	}()
+	return ln, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// Serve runs one NETCONF session on conn and closes it when the session ends.
+func (d *Device) Serve(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	// a pipe is unbuffered and the client writes its hello before reading ours, so writes get their own goroutine
+	out := make(chan []byte, 64)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for msg := range out {
+			if _, err := conn.Write(msg); err != nil {
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(out)
+		<-writerDone
+	}()
+
+	chunked := false
+	send := func(msg string) {
+		if chunked {
+			out <- []byte(fmt.Sprintf("\n#%d\n%s\n##\n", len(msg), msg))
+			return
+		}
+		out <- append([]byte(msg), eom...)
+	}
+	send(d.Hello())
+
+	r := bufio.NewReader(conn)
+	clientHello, err := readEOM(r)
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	d.hellos++
+	d.mu.Unlock()
+	chunked = strings.Contains(clientHello, Base11) && strings.Contains(d.Hello(), Base11)
+	if d.CloseAfterHello {
+		return
+	}
+
+	for {
+		var msg string
+		if chunked {
+			msg, err = readChunked(r)
+		} else {
+			msg, err = readEOM(r)
+		}
+		if err != nil {
+			return
+		}
+		msg = strings.TrimSpace(msg)
+		d.mu.Lock()
+		if strings.Contains(msg, "<hello") {
+			d.hellos++
+		} else {
+			d.received = append(d.received, msg)
+		}
+		d.mu.Unlock()
+
+		if strings.Contains(msg, "<close-session") {
+			if d.IgnoreCloseSession {
+				continue
+			}
+			send(Reply(msg, OK))
+			return
+		}
+		if d.CutOff != nil {
+			if partial := d.CutOff(msg); partial != "" {
+				out <- []byte(partial)
+				return
+			}
+		}
+		var replies []string
+		if d.Handle != nil {
+			replies = d.Handle(msg)
+		}
+		if replies == nil {
+			replies = []string{Reply(msg, OK)}
+		}
+		for _, m := range replies {
+			send(m)
+		}
+	}
+}
+
+func readEOM(r *bufio.Reader) (string, error) {
+	var b bytes.Buffer
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(c)
+		if bytes.HasSuffix(b.Bytes(), eom) {
+			return string(b.Bytes()[:b.Len()-len(eom)]), nil
+		}
+	}
+}
+
+// readChunked reads one RFC 6242 chunked message; the client is trusted to frame it correctly.
+func readChunked(r *bufio.Reader) (string, error) {
+	var payload bytes.Buffer
+	for {
+		header, err := r.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(strings.TrimSuffix(header, "#")) != "" {
+			return "", fmt.Errorf("malformed chunk header %q", header)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "#" {
+			return payload.String(), nil
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return "", fmt.Errorf("malformed chunk size %q", line)
+		}
+		if _, err := io.CopyN(&payload, r, int64(n)); err != nil {
+			return "", err
+		}
+	}
+}
+
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "netconftest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
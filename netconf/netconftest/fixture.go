@@ -0,0 +1,44 @@
+package netconftest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// fixture is the session record gonc writes with -emit-fixture.
+type fixture struct {
+	Hello     string `json:"hello"`
+	Exchanges []struct {
+		Request string `json:"request"`
+		Reply   string `json:"reply"`
+	} `json:"exchanges"`
+}
+
+// LoadFixture reads a session recorded with gonc -emit-fixture and returns a Device replaying it: it sends the
+// recorded hello and answers the n-th rpc of the session with the n-th recorded reply, unchanged. Rpcs beyond
+// the recording get an operation-failed rpc-error.
+func LoadFixture(r io.Reader) (*Device, error) {
+	var fx fixture
+	if err := json.NewDecoder(r).Decode(&fx); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture: %v", err)
+	}
+	if fx.Hello == "" {
+		return nil, fmt.Errorf("fixture has no hello")
+	}
+
+	var mu sync.Mutex
+	next := 0
+	d := &Device{HelloXML: fx.Hello}
+	d.Handle = func(rpc string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(fx.Exchanges) {
+			return []string{Reply(rpc, RPCError("operation-failed", "fixture has no reply for this rpc"))}
+		}
+		next++
+		return []string{fx.Exchanges[next-1].Reply}
+	}
+	return d, nil
+}
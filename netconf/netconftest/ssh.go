@@ -0,0 +1,128 @@
+package netconftest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// NewHostKey returns a fresh ed25519 host key for an ssh.ServerConfig.
+func NewHostKey() (ssh.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// ListenSSH serves the device over SSH on addr, e.g. 127.0.0.1:0, one NETCONF session per session channel, and
+// returns the port. config supplies the host key and the authentication; nil accepts any password under a fresh
+// host key. A session runs NETCONF once it requests the netconf subsystem or, when ExecCommand is set, exactly
+// that exec command instead. With RequirePty, both are refused until the session has requested a pty. Close the
+// listener when done.
+func (d *Device) ListenSSH(addr string, config *ssh.ServerConfig) (net.Listener, string, error) {
+	if config == nil {
+		key, err := NewHostKey()
+		if err != nil {
+			return nil, "", err
+		}
+		config = &ssh.ServerConfig{
+			PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) { return nil, nil },
+		}
+		config.AddHostKey(key)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serveSSH(conn, config)
+		}
+	}()
+	return ln, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// SessionRequests returns the requests made on SSH session channels, across all sessions, such as
+// "pty-req vt100 80x24", "subsystem netconf" or "exec xml-mode netconf need-trailer".
+func (d *Device) SessionRequests() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.sessionReqs...)
+}
+
+func (d *Device) serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go d.serveSession(ch, requests)
+	}
+}
+
+func (d *Device) serveSession(ch ssh.Channel, requests <-chan *ssh.Request) {
+	pty, started := false, false
+	for req := range requests {
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var p struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			if ssh.Unmarshal(req.Payload, &p) == nil {
+				pty = true
+				ok = true
+				d.recordSessionRequest(fmt.Sprintf("pty-req %s %dx%d", p.Term, p.Columns, p.Rows))
+			}
+		case "subsystem", "exec":
+			var p struct{ Value string }
+			if ssh.Unmarshal(req.Payload, &p) != nil {
+				break
+			}
+			d.recordSessionRequest(req.Type + " " + p.Value)
+			if req.Type == "subsystem" {
+				ok = p.Value == "netconf" && d.ExecCommand == ""
+			} else {
+				ok = d.ExecCommand != "" && p.Value == d.ExecCommand
+			}
+			ok = ok && !started && (pty || !d.RequirePty)
+			if ok {
+				started = true
+				req.Reply(true, nil)
+				go d.Serve(ch)
+				continue
+			}
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+func (d *Device) recordSessionRequest(r string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessionReqs = append(d.sessionReqs, r)
+}
@@ -0,0 +1,111 @@
+package netconf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// NMDACapability is the RFC 8526 ietf-netconf-nmda module namespace, advertised by devices supporting
+	// <get-data> and <edit-data>.
+	NMDACapability      = "urn:ietf:params:xml:ns:yang:ietf-netconf-nmda"
+	datastoresNamespace = "urn:ietf:params:xml:ns:yang:ietf-datastores"
+	originNamespace     = "urn:ietf:params:xml:ns:yang:ietf-origin"
+	withDefaultsNS      = "urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults"
+)
+
+// NMDADatastores are the RFC 8342 datastores accepted by BuildGetDataRPC.
+var NMDADatastores = []string{"running", "candidate", "startup", "intended", "operational"}
+
+// WithDefaultsModes are the RFC 6243 with-defaults retrieval modes accepted by BuildGetDataRPC.
+var WithDefaultsModes = []string{"report-all", "trim", "explicit", "report-all-tagged"}
+
+// GetDataOptions selects the datastore and filters of an RFC 8526 <get-data> request.
+type GetDataOptions struct {
+	Datastore     string // running, candidate, startup, intended or operational
+	SubtreeFilter string // optional subtree filter content
+	XPathFilter   string // optional XPath filter, instead of SubtreeFilter
+	OriginFilter  string // optional origin identity, e.g. "or:intended"; operational datastore only
+	WithOrigin    bool   // request origin metadata; operational datastore only
+	WithDefaults  string // optional with-defaults mode: report-all, trim, explicit or report-all-tagged
+}
+
+// BuildGetDataRPC builds an RFC 8526 <get-data> request.
+func BuildGetDataRPC(opts GetDataOptions) (string, error) {
+	if !slices.Contains(NMDADatastores, opts.Datastore) {
+		return "", fmt.Errorf("unknown datastore %q; use one of %s", opts.Datastore, strings.Join(NMDADatastores, ", "))
+	}
+	if opts.SubtreeFilter != "" && opts.XPathFilter != "" {
+		return "", fmt.Errorf("get-data takes a subtree filter or an XPath filter, not both")
+	}
+	if (opts.OriginFilter != "" || opts.WithOrigin) && opts.Datastore != "operational" {
+		return "", fmt.Errorf("origin filtering is only supported on the operational datastore")
+	}
+	if opts.WithDefaults != "" && !slices.Contains(WithDefaultsModes, opts.WithDefaults) {
+		return "", fmt.Errorf("unknown with-defaults mode %q; use one of %s", opts.WithDefaults, strings.Join(WithDefaultsModes, ", "))
+	}
+
+	var b strings.Builder
+	b.WriteString(`<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">`)
+	fmt.Fprintf(&b, `<get-data xmlns="%s" xmlns:ds="%s">`, NMDACapability, datastoresNamespace)
+	fmt.Fprintf(&b, `<datastore>ds:%s</datastore>`, opts.Datastore)
+	if opts.SubtreeFilter != "" {
+		fmt.Fprintf(&b, `<subtree-filter>%s</subtree-filter>`, opts.SubtreeFilter)
+	}
+	if opts.XPathFilter != "" {
+		fmt.Fprintf(&b, `<xpath-filter>%s</xpath-filter>`, escapeText(opts.XPathFilter))
+	}
+	if opts.OriginFilter != "" {
+		fmt.Fprintf(&b, `<origin-filter xmlns:or="%s">%s</origin-filter>`, originNamespace, escapeText(opts.OriginFilter))
+	}
+	if opts.WithOrigin {
+		b.WriteString(`<with-origin/>`)
+	}
+	if opts.WithDefaults != "" {
+		fmt.Fprintf(&b, `<with-defaults xmlns="%s">%s</with-defaults>`, withDefaultsNS, escapeText(opts.WithDefaults))
+	}
+	b.WriteString(`</get-data></rpc>`)
+
+	return b.String(), nil
+}
+
+// GetData retrieves an NMDA datastore, e.g. operational or intended, with <get-data>. The filter is optional:
+// a subtree filter when it starts with "<", an XPath expression otherwise, as for Get.
+func (s *Endpoint) GetData(datastore, filter string) (string, error) {
+	if !s.HasCapability(NMDACapability) {
+		return "", fmt.Errorf("device does not advertise the %s capability required for get-data", NMDACapability)
+	}
+	opts := GetDataOptions{Datastore: datastore}
+	if filter = strings.TrimSpace(filter); strings.HasPrefix(filter, "<") {
+		if err := checkWellFormed(filter); err != nil {
+			return "", fmt.Errorf("subtree filter is not well-formed XML: %v", err)
+		}
+		opts.SubtreeFilter = filter
+	} else if filter != "" {
+		if !s.HasCapability(":xpath") {
+			return "", fmt.Errorf("device does not support XPath filters (no :xpath capability advertised)")
+		}
+		opts.XPathFilter = filter
+	}
+	rpc, err := BuildGetDataRPC(opts)
+	if err != nil {
+		return "", err
+	}
+	return s.Run(rpc)
+}
+
+// EditData merges config into a writable NMDA datastore (running, candidate or startup) with <edit-data>.
+func (s *Endpoint) EditData(datastore, config string) (string, error) {
+	if !s.HasCapability(NMDACapability) {
+		return "", fmt.Errorf("device does not advertise the %s capability required for edit-data", NMDACapability)
+	}
+	if err := s.requireDatastore(datastore); err != nil {
+		return "", err
+	}
+	if err := checkWellFormed(config); err != nil {
+		return "", fmt.Errorf("edit-data config is not well-formed XML: %v", err)
+	}
+	return s.Run(rpcEnvelope(fmt.Sprintf(`<edit-data xmlns="%s" xmlns:ds="%s"><datastore>ds:%s</datastore><config>%s</config></edit-data>`,
+		NMDACapability, datastoresNamespace, datastore, config)))
+}
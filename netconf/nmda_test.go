@@ -0,0 +1,106 @@
+package netconf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+func TestBuildGetDataRPC(t *testing.T) {
+	const open = `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` +
+		`<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">`
+	const closing = `</get-data></rpc>`
+	tests := []struct {
+		name    string
+		opts    GetDataOptions
+		want    string
+		wantErr string
+	}{
+		{"operational", GetDataOptions{Datastore: "operational"},
+			open + `<datastore>ds:operational</datastore>` + closing, ""},
+		{"operational with origin and defaults", GetDataOptions{Datastore: "operational", OriginFilter: "or:intended", WithOrigin: true, WithDefaults: "report-all"},
+			open + `<datastore>ds:operational</datastore>` +
+				`<origin-filter xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">or:intended</origin-filter><with-origin/>` +
+				`<with-defaults xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-with-defaults">report-all</with-defaults>` + closing, ""},
+		{"origin filter escaped", GetDataOptions{Datastore: "operational", OriginFilter: "or:intended</origin-filter><x>"},
+			open + `<datastore>ds:operational</datastore>` +
+				`<origin-filter xmlns:or="urn:ietf:params:xml:ns:yang:ietf-origin">or:intended&lt;/origin-filter&gt;&lt;x&gt;</origin-filter>` + closing, ""},
+		{"xpath filter escaped", GetDataOptions{Datastore: "intended", XPathFilter: "/if:interfaces/if:interface[if:mtu<1500]"},
+			open + `<datastore>ds:intended</datastore><xpath-filter>/if:interfaces/if:interface[if:mtu&lt;1500]</xpath-filter>` + closing, ""},
+		{"unknown datastore", GetDataOptions{Datastore: "ds:operational"}, "", `unknown datastore "ds:operational"`},
+		{"origin on running", GetDataOptions{Datastore: "running", WithOrigin: true}, "", "only supported on the operational datastore"},
+		{"unknown with-defaults", GetDataOptions{Datastore: "operational", WithDefaults: "all"}, "", `unknown with-defaults mode "all"`},
+		{"both filters", GetDataOptions{Datastore: "running", SubtreeFilter: "<system/>", XPathFilter: "/system"}, "", "not both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildGetDataRPC(tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("BuildGetDataRPC error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildGetDataRPC: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("BuildGetDataRPC =\n%s\nwant\n%s", got, tt.want)
+			}
+			if err := checkWellFormed(got); err != nil {
+				t.Errorf("BuildGetDataRPC output is not well-formed: %v", err)
+			}
+		})
+	}
+}
+
+// TestGetData checks the <get-data> Endpoint.GetData sends for a datastore plus a subtree or XPath filter.
+func TestGetData(t *testing.T) {
+	const (
+		nmda  = NMDACapability + "?module=ietf-netconf-nmda&amp;revision=2019-01-07"
+		xpath = "urn:ietf:params:netconf:capability:xpath:1.0"
+		open  = `<rpc message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` +
+			`<get-data xmlns="urn:ietf:params:xml:ns:yang:ietf-netconf-nmda" xmlns:ds="urn:ietf:params:xml:ns:yang:ietf-datastores">`
+	)
+	tests := []struct {
+		name      string
+		caps      []string
+		datastore string
+		filter    string
+		want      string
+		wantErr   string
+	}{
+		{"operational subtree", []string{baseCapability11, nmda}, "operational", `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/>`,
+			open + `<datastore>ds:operational</datastore><subtree-filter><interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"/></subtree-filter></get-data></rpc>`, ""},
+		{"intended xpath", []string{baseCapability11, nmda, xpath}, "intended", "/system/hostname",
+			open + `<datastore>ds:intended</datastore><xpath-filter>/system/hostname</xpath-filter></get-data></rpc>`, ""},
+		{"running unfiltered", []string{baseCapability11, nmda}, "running", "",
+			open + `<datastore>ds:running</datastore></get-data></rpc>`, ""},
+		{"no nmda", []string{baseCapability11}, "operational", "", "", "required for get-data"},
+		{"xpath without :xpath", []string{baseCapability11, nmda}, "operational", "/system", "", "no :xpath capability"},
+		{"malformed subtree", []string{baseCapability11, nmda}, "operational", "<system>", "", "not well-formed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(tt.caps...)
+			s := connectFake(t, f)
+			_, err := s.GetData(tt.datastore, tt.filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetData error = %v, want %q", err, tt.wantErr)
+				}
+				if reqs := f.Requests(); len(reqs) != 0 {
+					t.Errorf("device received %q, want nothing sent", reqs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetData: %v", err)
+			}
+			if reqs := f.Requests(); len(reqs) != 1 || reqs[0] != tt.want {
+				t.Errorf("device received %q, want %q", reqs, tt.want)
+			}
+		})
+	}
+}
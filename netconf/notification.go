@@ -0,0 +1,96 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	notificationCapability = "urn:ietf:params:netconf:capability:notification:1.0"
+	notificationNamespace  = "urn:ietf:params:xml:ns:netconf:notification:1.0"
+	yangPushNamespace      = "urn:ietf:params:xml:ns:yang:ietf-yang-push"
+)
+
+// StreamsRPC reads the available event streams from the RFC 5277 /netconf/streams container.
+const StreamsRPC = `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <get>
+    <filter type="subtree">
+      <netconf xmlns="urn:ietf:params:xml:ns:netmod:notification">
+        <streams/>
+      </netconf>
+    </filter>
+  </get>
+</rpc>`
+
+// RequireNotifications returns an error unless the device advertises RFC 5277 notifications or yang-push.
+func RequireNotifications(s *Endpoint) error {
+	if s.HasCapability(notificationCapability) || s.HasCapability(yangPushNamespace) {
+		return nil
+	}
+	return fmt.Errorf("device does not support notifications (no %s or yang-push capability advertised)", notificationCapability)
+}
+
+// ErrSubscribed is returned by Run once the session carries a notification subscription, since the
+// subscription goroutine owns every message read from then on.
+var ErrSubscribed = errors.New("session is dedicated to a notification subscription")
+
+// Subscribe sends <create-subscription> for stream (NETCONF when empty) and delivers every notification
+// that follows on the returned channel, without the ]]>]]> delimiter, starting with any that arrived while Run
+// was waiting for a reply. startTime asks for replay and stopTime ends the subscription; both may be nil.
+// The channel is closed when the session ends, e.g. on Disconnect.
+func (s *Endpoint) Subscribe(stream string, startTime, stopTime *time.Time) (<-chan string, error) {
+	if !s.HasCapability(notificationCapability) {
+		return nil, fmt.Errorf("device does not advertise %s, required for create-subscription", notificationCapability)
+	}
+	if stopTime != nil && startTime == nil {
+		return nil, fmt.Errorf("stopTime requires startTime")
+	}
+	if stopTime != nil && stopTime.Before(*startTime) {
+		return nil, fmt.Errorf("stopTime %v is before startTime %v", stopTime, startTime)
+	}
+
+	var op strings.Builder
+	fmt.Fprintf(&op, `<create-subscription xmlns="%s">`, notificationNamespace)
+	if stream != "" {
+		fmt.Fprintf(&op, "<stream>%s</stream>", escapeText(stream))
+	}
+	if startTime != nil {
+		fmt.Fprintf(&op, "<startTime>%s</startTime>", startTime.Format(time.RFC3339))
+	}
+	if stopTime != nil {
+		fmt.Fprintf(&op, "<stopTime>%s</stopTime>", stopTime.Format(time.RFC3339))
+	}
+	op.WriteString("</create-subscription>")
+
+	if _, err := s.Run(rpcEnvelope(op.String())); err != nil {
+		return nil, err
+	}
+	s.subscribed = true
+
+	notifications := make(chan string)
+	queued := s.queued
+	s.queued = nil
+	go func() {
+		defer close(notifications)
+		// notifications that came in ahead of a reply, e.g. replay sent before the create-subscription reply
+		for _, msg := range queued {
+			notifications <- msg
+		}
+		for {
+			msg, err := s.readMessage()
+			if err != nil {
+				if !errors.Is(err, ErrChannelClosed) && !s.closing.Load() {
+					s.logger().Error("subscription ended", "error", err)
+				}
+				return
+			}
+			msg = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(msg), "]]>]]>"))
+			if msg != "" {
+				notifications <- msg
+			}
+		}
+	}()
+	return notifications, nil
+}
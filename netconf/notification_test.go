@@ -0,0 +1,95 @@
+package netconf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+const testNotification = `<notification xmlns="urn:ietf:params:xml:ns:netconf:notification:1.0">` +
+	`<eventTime>2026-01-01T00:00:00Z</eventTime><netconf-config-change/></notification>`
+
+func TestNotificationBeforeReplyIsQueued(t *testing.T) {
+	tests := []struct {
+		name string
+		caps []string
+	}{
+		{"1.0 framing", []string{baseCapability10, notificationCapability}},
+		{"1.1 framing", []string{baseCapability11, notificationCapability}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(tt.caps...)
+			f.Handle = func(rpc string) []string {
+				if strings.Contains(rpc, "<get/>") {
+					return []string{testNotification, reply(rpc, "<data/>")}
+				}
+				return nil
+			}
+			s := connectFake(t, f)
+
+			got, err := s.Run(getRPC)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !strings.Contains(got, "<data/>") {
+				t.Fatalf("Run returned %q, want the <get> reply", got)
+			}
+
+			notifications, err := s.Subscribe("", nil, nil)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			select {
+			case n := <-notifications:
+				if n != testNotification {
+					t.Errorf("first notification = %q, want %q", n, testNotification)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("queued notification was not delivered")
+			}
+		})
+	}
+}
+
+func TestRequireNotifications(t *testing.T) {
+	tests := []struct {
+		name          string
+		caps          []string
+		wantErr       bool
+		wantSubscribe bool
+	}{
+		{"notification", []string{baseCapability10, notificationCapability}, false, true},
+		{"yang-push only", []string{baseCapability10, yangPushNamespace + "?module=ietf-yang-push&amp;revision=2019-09-09"}, false, false},
+		{"neither", []string{baseCapability10}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(tt.caps...)
+			s := connectFake(t, f)
+			err := RequireNotifications(s)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "device does not support notifications") {
+					t.Errorf("RequireNotifications = %v, want the device does not support notifications", err)
+				}
+			} else if err != nil {
+				t.Errorf("RequireNotifications: %v", err)
+			}
+
+			// create-subscription is RFC 5277, so yang-push alone is not enough for it
+			_, err = s.Subscribe("", nil, nil)
+			if tt.wantSubscribe != (err == nil) {
+				t.Errorf("Subscribe error = %v, want success %v", err, tt.wantSubscribe)
+			}
+			sent := false
+			for _, req := range f.Requests() {
+				sent = sent || strings.Contains(req, "<create-subscription")
+			}
+			if sent != tt.wantSubscribe {
+				t.Errorf("create-subscription sent = %v, want %v", sent, tt.wantSubscribe)
+			}
+		})
+	}
+}
@@ -0,0 +1,510 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const baseNamespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+// rpcEnvelope wraps a single operation element in an <rpc>; Run assigns the message-id.
+func rpcEnvelope(operation string) string {
+	return fmt.Sprintf(`<rpc xmlns="%s">%s</rpc>`, baseNamespace, operation)
+}
+
+// WrapRPC wraps a bare operation such as <get-config>...</get-config> in an <rpc> envelope. Payloads whose
+// first element is already <rpc> or <hello> are returned unchanged; leading whitespace, comments and the XML
+// declaration are skipped when looking.
+func WrapRPC(payload string) (string, error) {
+	body := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(payload), "]]>]]>"))
+	decoder := xml.NewDecoder(strings.NewReader(body))
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return "", fmt.Errorf("payload contains no XML element")
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse payload: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				// the declaration can't end up inside the envelope
+				body = strings.TrimSpace(body[decoder.InputOffset():])
+				decoder = xml.NewDecoder(strings.NewReader(body))
+			}
+		case xml.StartElement:
+			if t.Name.Local == "rpc" || t.Name.Local == "hello" {
+				return payload, nil
+			}
+			return rpcEnvelope(body), nil
+		}
+	}
+}
+
+// peekSize bounds how far into a streamed payload WrapRPCReader and RunReader look for the first element.
+const peekSize = 64 * 1024
+
+// firstElement finds the first element of head, skipping the XML declaration, comments and whitespace, and
+// returns its local name with the offsets where its start tag begins and ends. ok is false when head holds no
+// complete start tag.
+func firstElement(head []byte) (name string, start, end int, ok bool) {
+	decoder := xml.NewDecoder(bytes.NewReader(head))
+	for {
+		start = int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err != nil {
+			return "", 0, 0, false
+		}
+		if t, isStart := token.(xml.StartElement); isStart {
+			return t.Name.Local, start, int(decoder.InputOffset()), true
+		}
+	}
+}
+
+// WrapRPCReader is WrapRPC for a streamed payload: when the first element of r isn't <rpc> or <hello>, the
+// returned reader yields r inside an <rpc> envelope, with anything before that element and a trailing
+// end-of-message delimiter dropped. Only the first 64 KiB are looked at, so the payload is never held whole.
+func WrapRPCReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, peekSize)
+	head, err := br.Peek(peekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read the rpc payload: %v", err)
+	}
+	name, start, _, ok := firstElement(head)
+	if !ok {
+		return nil, fmt.Errorf("payload contains no XML element in its first %d KiB", peekSize/1024)
+	}
+	if name == "rpc" || name == "hello" {
+		return br, nil
+	}
+	// the declaration can't end up inside the envelope
+	if _, err := br.Discard(start); err != nil {
+		return nil, fmt.Errorf("failed to read the rpc payload: %v", err)
+	}
+	return &envelopeReader{r: br, pending: fmt.Appendf(nil, `<rpc xmlns="%s">`, baseNamespace)}, nil
+}
+
+// envelopeReader streams an operation followed by the closing </rpc>, holding back a short tail so a trailing
+// end-of-message delimiter can be moved after it.
+type envelopeReader struct {
+	r       io.Reader
+	buf     []byte
+	out     []byte // backs pending once the prefix is sent
+	pending []byte
+	tail    []byte
+	done    bool
+}
+
+func (e *envelopeReader) Read(p []byte) (int, error) {
+	const tailSize = 64
+	if e.buf == nil {
+		e.buf = make([]byte, 32*1024)
+	}
+	for len(e.pending) == 0 && !e.done {
+		n, err := e.r.Read(e.buf)
+		e.tail = append(e.tail, e.buf[:n]...)
+		if len(e.tail) > tailSize {
+			e.out = append(e.out[:0], e.tail[:len(e.tail)-tailSize]...)
+			e.pending = e.out
+			e.tail = append(e.tail[:0], e.tail[len(e.tail)-tailSize:]...)
+		}
+		if err == io.EOF {
+			body := bytes.TrimSuffix(bytes.TrimRight(e.tail, " \t\r\n"), []byte("]]>]]>"))
+			body = bytes.TrimRight(body, " \t\r\n")
+			e.pending = append(append(e.pending, body...), "</rpc>"...)
+			e.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if len(e.pending) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// requireDatastore checks the device offers the configuration datastore; candidate and startup are optional (RFC 6241 section 8).
+func (s *Endpoint) requireDatastore(datastore string) error {
+	switch datastore {
+	case "running":
+		return nil
+	case "candidate", "startup":
+		if !s.HasCapability(":" + datastore) {
+			return fmt.Errorf("device does not support the %s datastore (no :%s capability advertised)", datastore, datastore)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported datastore %q; use running, candidate or startup", datastore)
+	}
+}
+
+// filterElement builds the <filter> element of a get or get-config. Filters starting with "<" are subtree
+// filters, anything else is an XPath expression, which needs the :xpath capability.
+func (s *Endpoint) filterElement(filter string) (string, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(filter, "<") {
+		if err := checkWellFormed(filter); err != nil {
+			return "", fmt.Errorf("subtree filter is not well-formed XML: %v", err)
+		}
+		return `<filter type="subtree">` + filter + `</filter>`, nil
+	}
+	if !s.HasCapability(":xpath") {
+		return "", fmt.Errorf("device does not support XPath filters (no :xpath capability advertised)")
+	}
+	return `<filter type="xpath" select="` + escapeText(filter) + `"/>`, nil
+}
+
+// checkWellFormed parses an XML fragment, which may hold several top-level elements.
+func checkWellFormed(fragment string) error {
+	decoder := xml.NewDecoder(strings.NewReader("<fragment>" + fragment + "</fragment>"))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Get retrieves running configuration and state data, optionally narrowed by a subtree or XPath filter.
+func (s *Endpoint) Get(filter string) (string, error) {
+	filterXML, err := s.filterElement(filter)
+	if err != nil {
+		return "", err
+	}
+	return s.Run(rpcEnvelope(`<get>` + filterXML + `</get>`))
+}
+
+// GetConfig retrieves the running, candidate or startup datastore, optionally narrowed by a subtree or XPath filter.
+func (s *Endpoint) GetConfig(datastore, filter string) (string, error) {
+	if err := s.requireDatastore(datastore); err != nil {
+		return "", err
+	}
+	filterXML, err := s.filterElement(filter)
+	if err != nil {
+		return "", err
+	}
+	return s.Run(rpcEnvelope(fmt.Sprintf(`<get-config><source><%s/></source>%s</get-config>`, datastore, filterXML)))
+}
+
+// EditConfigOptions are the optional parameters of an edit-config; empty fields are left out of the request.
+type EditConfigOptions struct {
+	DefaultOperation string // merge, replace or none
+	TestOption       string // test-then-set, set or test-only
+	ErrorOption      string // stop-on-error, continue-on-error or rollback-on-error
+}
+
+func checkOption(name, value string, allowed ...string) error {
+	if value == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported %s %q; use %s", name, value, strings.Join(allowed, ", "))
+}
+
+// EditConfig loads configXML into the running or candidate datastore. configXML is the content of the <config>
+// element; it is wrapped in one unless it already is.
+func (s *Endpoint) EditConfig(target, configXML string, opts EditConfigOptions) (string, error) {
+	switch target {
+	case "running":
+		if !s.HasCapability(":writable-running") {
+			return "", fmt.Errorf("device does not allow editing the running datastore (no :writable-running capability advertised)")
+		}
+	case "candidate":
+		if err := s.requireDatastore(target); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported edit-config target %q; use running or candidate", target)
+	}
+
+	if err := checkOption("default-operation", opts.DefaultOperation, "merge", "replace", "none"); err != nil {
+		return "", err
+	}
+	if err := checkOption("test-option", opts.TestOption, "test-then-set", "set", "test-only"); err != nil {
+		return "", err
+	}
+	if err := checkOption("error-option", opts.ErrorOption, "stop-on-error", "continue-on-error", "rollback-on-error"); err != nil {
+		return "", err
+	}
+	if opts.TestOption == "test-only" && !s.HasCapability(":validate") {
+		return "", fmt.Errorf("test-option test-only requires the :validate capability, which the device does not advertise")
+	}
+
+	configXML = wrapConfig(configXML)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<edit-config><target><%s/></target>`, target)
+	if opts.DefaultOperation != "" {
+		fmt.Fprintf(&b, `<default-operation>%s</default-operation>`, opts.DefaultOperation)
+	}
+	if opts.TestOption != "" {
+		fmt.Fprintf(&b, `<test-option>%s</test-option>`, opts.TestOption)
+	}
+	if opts.ErrorOption != "" {
+		fmt.Fprintf(&b, `<error-option>%s</error-option>`, opts.ErrorOption)
+	}
+	b.WriteString(configXML)
+	b.WriteString(`</edit-config>`)
+
+	return s.Run(rpcEnvelope(b.String()))
+}
+
+// wrapConfig wraps configXML in a <config> element unless its first element already is one. Only the exact
+// local name counts, so a vendor <configuration> root still gets wrapped.
+func wrapConfig(configXML string) string {
+	configXML = strings.TrimSpace(configXML)
+	decoder := xml.NewDecoder(strings.NewReader(configXML))
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			break
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local == "config" {
+				return configXML
+			}
+			break
+		}
+	}
+	return "<config>" + configXML + "</config>"
+}
+
+// LockError is returned by Lock when the datastore is already locked.
+type LockError struct {
+	Datastore string
+	SessionID string // session holding the lock, "0" when it isn't a NETCONF session
+	Err       *RPCError
+}
+
+func (e *LockError) Error() string {
+	switch e.SessionID {
+	case "":
+		return fmt.Sprintf("%s datastore is already locked", e.Datastore)
+	case "0":
+		return fmt.Sprintf("%s datastore is locked outside of NETCONF", e.Datastore)
+	default:
+		return fmt.Sprintf("%s datastore is locked by session %s", e.Datastore, e.SessionID)
+	}
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// Lock locks the datastore for this session. A datastore locked by someone else is reported as a *LockError.
+func (s *Endpoint) Lock(datastore string) error {
+	if err := s.requireDatastore(datastore); err != nil {
+		return err
+	}
+	_, err := s.Run(rpcEnvelope(fmt.Sprintf(`<lock><target><%s/></target></lock>`, datastore)))
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Tag == "lock-denied" {
+		return &LockError{Datastore: datastore, SessionID: rpcErr.SessionID, Err: rpcErr}
+	}
+	return err
+}
+
+// Unlock releases a lock taken with Lock.
+func (s *Endpoint) Unlock(datastore string) error {
+	if err := s.requireDatastore(datastore); err != nil {
+		return err
+	}
+	_, err := s.Run(rpcEnvelope(fmt.Sprintf(`<unlock><target><%s/></target></unlock>`, datastore)))
+	return err
+}
+
+// WithLock runs fn while holding the datastore lock. The lock is released even when fn fails or panics;
+// an unlock failure is only returned if fn itself succeeded.
+func (s *Endpoint) WithLock(datastore string, fn func() error) (err error) {
+	if err := s.Lock(datastore); err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := s.Unlock(datastore); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+	return fn()
+}
+
+// KillSession forces another NETCONF session closed, releasing any locks it holds, e.g. the SessionID of a *LockError.
+func (s *Endpoint) KillSession(sessionID int) error {
+	if sessionID <= 0 {
+		return fmt.Errorf("kill-session needs a positive session-id, got %d", sessionID)
+	}
+	if sessionID == s.SessionID() {
+		return fmt.Errorf("session %d is this session, use Disconnect instead of kill-session", sessionID)
+	}
+	_, err := s.Run(rpcEnvelope(fmt.Sprintf(`<kill-session><session-id>%d</session-id></kill-session>`, sessionID)))
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Tag == "access-denied" {
+		return fmt.Errorf("not permitted to kill session %d: %w", sessionID, rpcErr)
+	}
+	return err
+}
+
+func (s *Endpoint) requireCandidate(operation string) error {
+	if !s.HasCapability(":candidate") {
+		return fmt.Errorf("%s requires the :candidate capability, which the device does not advertise", operation)
+	}
+	return nil
+}
+
+func escapeText(v string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(v))
+	return b.String()
+}
+
+// Commit copies the candidate datastore to running, also confirming a pending confirmed commit.
+func (s *Endpoint) Commit() error {
+	if err := s.requireCandidate("commit"); err != nil {
+		return err
+	}
+	_, err := s.Run(rpcEnvelope(`<commit/>`))
+	return err
+}
+
+// DiscardChanges reverts the candidate datastore to the running configuration.
+func (s *Endpoint) DiscardChanges() error {
+	if err := s.requireCandidate("discard-changes"); err != nil {
+		return err
+	}
+	_, err := s.Run(rpcEnvelope(`<discard-changes/>`))
+	return err
+}
+
+// ConfirmedCommit commits the candidate but rolls back unless it is confirmed with Commit within timeout,
+// rounded up to whole seconds (the device default of 600s when zero). A non-empty persist token lets the commit be confirmed or
+// cancelled from another session, and needs :confirmed-commit:1.1.
+func (s *Endpoint) ConfirmedCommit(timeout time.Duration, persist string) error {
+	if err := s.requireCandidate("confirmed commit"); err != nil {
+		return err
+	}
+	if !s.HasCapability(":confirmed-commit") {
+		return fmt.Errorf("device does not support confirmed commits (no :confirmed-commit capability advertised)")
+	}
+	if persist != "" && !s.HasCapability(":confirmed-commit:1.1") {
+		return fmt.Errorf("persistent confirmed commits require the :confirmed-commit:1.1 capability, which the device does not advertise")
+	}
+
+	var b strings.Builder
+	b.WriteString(`<commit><confirmed/>`)
+	if timeout > 0 {
+		fmt.Fprintf(&b, `<confirm-timeout>%d</confirm-timeout>`, (timeout+time.Second-1)/time.Second)
+	}
+	if persist != "" {
+		fmt.Fprintf(&b, `<persist>%s</persist>`, escapeText(persist))
+	}
+	b.WriteString(`</commit>`)
+
+	_, err := s.Run(rpcEnvelope(b.String()))
+	return err
+}
+
+// CancelCommit rolls back a pending confirmed commit. persistID is required when the commit was started
+// from another session with a persist token, and empty otherwise.
+func (s *Endpoint) CancelCommit(persistID string) error {
+	if !s.HasCapability(":confirmed-commit:1.1") {
+		return fmt.Errorf("cancel-commit requires the :confirmed-commit:1.1 capability, which the device does not advertise")
+	}
+	rpc := `<cancel-commit/>`
+	if persistID != "" {
+		rpc = fmt.Sprintf(`<cancel-commit><persist-id>%s</persist-id></cancel-commit>`, escapeText(persistID))
+	}
+	_, err := s.Run(rpcEnvelope(rpc))
+	return err
+}
+
+// Validate checks a datastore (running, candidate or startup) or, when source starts with "<", an inline
+// configuration, which is wrapped in <config> unless it already is.
+func (s *Endpoint) Validate(source string) (string, error) {
+	if !s.HasCapability(":validate") {
+		return "", fmt.Errorf("device does not support validate (no :validate:1.0 or :validate:1.1 capability advertised)")
+	}
+
+	source = strings.TrimSpace(source)
+	var sourceXML string
+	if strings.HasPrefix(source, "<") {
+		sourceXML = wrapConfig(source)
+	} else {
+		if err := s.requireDatastore(source); err != nil {
+			return "", err
+		}
+		sourceXML = fmt.Sprintf(`<%s/>`, source)
+	}
+
+	return s.Run(rpcEnvelope(`<validate><source>` + sourceXML + `</source></validate>`))
+}
+
+// configLocation builds the element naming a datastore, or a <url> when name contains "://". URLs need the
+// :url capability and a scheme listed in its scheme parameter.
+func (s *Endpoint) configLocation(name string) (string, error) {
+	scheme, _, isURL := strings.Cut(name, "://")
+	if !isURL {
+		if err := s.requireDatastore(name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`<%s/>`, name), nil
+	}
+
+	for _, c := range s.ParsedCapabilities {
+		if !c.matches(":url") {
+			continue
+		}
+		schemes := strings.Split(c.Params.Get("scheme"), ",")
+		for _, allowed := range schemes {
+			if strings.EqualFold(strings.TrimSpace(allowed), scheme) {
+				return `<url>` + escapeText(name) + `</url>`, nil
+			}
+		}
+		return "", fmt.Errorf("device does not accept %s URLs; supported schemes: %s", scheme, c.Params.Get("scheme"))
+	}
+	return "", fmt.Errorf("device does not support URL datastores (no :url capability advertised)")
+}
+
+// CopyConfig replaces the target configuration with the source; either can be a datastore name or a URL.
+func (s *Endpoint) CopyConfig(target, source string) error {
+	targetXML, err := s.configLocation(target)
+	if err != nil {
+		return err
+	}
+	sourceXML, err := s.configLocation(source)
+	if err != nil {
+		return err
+	}
+	_, err = s.Run(rpcEnvelope(`<copy-config><target>` + targetXML + `</target><source>` + sourceXML + `</source></copy-config>`))
+	return err
+}
+
+// DeleteConfig deletes a datastore or URL configuration. The running datastore can't be deleted (RFC 6241 section 7.4).
+func (s *Endpoint) DeleteConfig(target string) error {
+	if target == "running" {
+		return fmt.Errorf("the running datastore cannot be deleted")
+	}
+	targetXML, err := s.configLocation(target)
+	if err != nil {
+		return err
+	}
+	_, err = s.Run(rpcEnvelope(`<delete-config><target>` + targetXML + `</target></delete-config>`))
+	return err
+}
@@ -0,0 +1,87 @@
+package netconf
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+const (
+	writableRunningCapability = "urn:ietf:params:netconf:capability:writable-running:1.0"
+	candidateCapability       = "urn:ietf:params:netconf:capability:candidate:1.0"
+	validateCapability        = "urn:ietf:params:netconf:capability:validate:1.1"
+	confirmedCommitCapability = "urn:ietf:params:netconf:capability:confirmed-commit:1.1"
+)
+
+func TestEditConfigWrapsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"bare content", `<system><hostname>r1</hostname></system>`, `<config><system><hostname>r1</hostname></system></config>`},
+		{"already wrapped", `<config xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><system/></config>`, `<config xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><system/></config>`},
+		{"prefixed config", `<nc:config xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"><system/></nc:config>`, `<nc:config xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"><system/></nc:config>`},
+		{"vendor configuration root", `<configuration><system/></configuration>`, `<config><configuration><system/></configuration></config>`},
+		{"comment before config", `<!-- r1 --><config><system/></config>`, `<!-- r1 --><config><system/></config>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := netconftest.NewDevice(netconftest.Base10, netconftest.Base11, writableRunningCapability)
+			s := connectFake(t, f)
+			if _, err := s.EditConfig("running", tt.payload, EditConfigOptions{}); err != nil {
+				t.Fatalf("EditConfig: %v", err)
+			}
+			reqs := f.Requests()
+			if want := `<edit-config><target><running/></target>` + tt.want + `</edit-config>`; len(reqs) != 1 || !strings.Contains(reqs[0], want) {
+				t.Errorf("sent %q, want it to contain %q", reqs, want)
+			}
+		})
+	}
+}
+
+func TestValidateWrapsConfig(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"candidate", `<source><candidate/></source>`},
+		{`<system/>`, `<source><config><system/></config></source>`},
+		{`<config><system/></config>`, `<source><config><system/></config></source>`},
+		{`<configuration><system/></configuration>`, `<source><config><configuration><system/></configuration></config></source>`},
+	}
+	for _, tt := range tests {
+		f := netconftest.NewDevice(netconftest.Base10, validateCapability, candidateCapability)
+		s := connectFake(t, f)
+		if _, err := s.Validate(tt.source); err != nil {
+			t.Fatalf("Validate(%s): %v", tt.source, err)
+		}
+		if reqs := f.Requests(); len(reqs) != 1 || !strings.Contains(reqs[0], tt.want) {
+			t.Errorf("Validate(%s) sent %q, want it to contain %q", tt.source, reqs, tt.want)
+		}
+	}
+}
+
+func TestConfirmedCommitTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    string
+	}{
+		{0, `<commit><confirmed/></commit>`},
+		{500 * time.Millisecond, `<commit><confirmed/><confirm-timeout>1</confirm-timeout></commit>`},
+		{1500 * time.Millisecond, `<commit><confirmed/><confirm-timeout>2</confirm-timeout></commit>`},
+		{90 * time.Second, `<commit><confirmed/><confirm-timeout>90</confirm-timeout></commit>`},
+	}
+	for _, tt := range tests {
+		f := netconftest.NewDevice(netconftest.Base10, candidateCapability, confirmedCommitCapability)
+		s := connectFake(t, f)
+		if err := s.ConfirmedCommit(tt.timeout, ""); err != nil {
+			t.Fatalf("ConfirmedCommit(%v): %v", tt.timeout, err)
+		}
+		if reqs := f.Requests(); len(reqs) != 1 || !strings.Contains(reqs[0], tt.want) {
+			t.Errorf("ConfirmedCommit(%v) sent %q, want it to contain %q", tt.timeout, reqs, tt.want)
+		}
+	}
+}
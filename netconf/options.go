@@ -0,0 +1,151 @@
+package netconf
+
+import (
+	"io"
+	"log/slog"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Option configures an Endpoint built by NewEndpoint.
+type Option func(*Endpoint)
+
+// NewEndpoint returns an Endpoint for the device at ip, on port 830 with a 30 second timeout unless overridden.
+func NewEndpoint(ip string, opts ...Option) *Endpoint {
+	s := &Endpoint{
+		Ip:      ip,
+		Port:    "830",
+		Timeout: 30,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithPort sets the NETCONF port.
+func WithPort(port string) Option {
+	return func(s *Endpoint) { s.Port = port }
+}
+
+// WithPassword authenticates as username with a password.
+func WithPassword(username, password string) Option {
+	return func(s *Endpoint) {
+		s.Username = username
+		s.Password = password
+	}
+}
+
+// WithPrivateKey adds key-file authentication; passphrase may be empty for unencrypted keys.
+func WithPrivateKey(path, passphrase string) Option {
+	return func(s *Endpoint) {
+		s.PrivKeyPath = path
+		s.KeyPassphrase = passphrase
+	}
+}
+
+// WithKeyAlgorithms restricts the public-key signature algorithms offered for the private key.
+func WithKeyAlgorithms(algorithms ...string) Option {
+	return func(s *Endpoint) { s.KeyAlgorithms = algorithms }
+}
+
+// WithAgent adds the keys held by the ssh-agent at $SSH_AUTH_SOCK.
+func WithAgent() Option {
+	return func(s *Endpoint) { s.UseAgent = true }
+}
+
+// WithTimeout sets the connect timeout in seconds.
+func WithTimeout(seconds int) Option {
+	return func(s *Endpoint) { s.Timeout = seconds }
+}
+
+// WithRPCTimeout sets how long, in seconds, Run waits for a reply.
+func WithRPCTimeout(seconds int) Option {
+	return func(s *Endpoint) { s.RPCTimeout = seconds }
+}
+
+// WithHostKeyPolicy sets the host key policy (strict, warn or ignore) and the known_hosts file it uses.
+func WithHostKeyPolicy(policy, knownHostsPath string) Option {
+	return func(s *Endpoint) {
+		s.HostKeyPolicy = policy
+		s.KnownHostsPath = knownHostsPath
+	}
+}
+
+// WithHostKeyCallback verifies host keys with cb, overriding any host key policy.
+func WithHostKeyCallback(cb ssh.HostKeyCallback) Option {
+	return func(s *Endpoint) { s.HostKeyCallback = cb }
+}
+
+// WithStrictHello rejects server hellos without a base capability or session-id.
+func WithStrictHello() Option {
+	return func(s *Endpoint) { s.StrictHello = true }
+}
+
+// WithMaxHelloBytes caps the size of the server hello.
+func WithMaxHelloBytes(n int) Option {
+	return func(s *Endpoint) { s.MaxHelloBytes = n }
+}
+
+// WithNetconfCommand starts NETCONF with an exec command instead of the netconf subsystem.
+func WithNetconfCommand(command string) Option {
+	return func(s *Endpoint) { s.NetconfCommand = command }
+}
+
+// WithPty requests a pseudo-terminal of the given type and size before starting NETCONF.
+func WithPty(term string, width, height int) Option {
+	return func(s *Endpoint) {
+		s.RequestPty = true
+		s.PtyTerm = term
+		s.PtyWidth = width
+		s.PtyHeight = height
+	}
+}
+
+// WithJumpHost tunnels the connection through the SSH bastion at addr (host:port), authenticating
+// as username with password and/or the unencrypted key at keyPath.
+func WithJumpHost(addr, username, password, keyPath string) Option {
+	return func(s *Endpoint) {
+		s.JumpHost = addr
+		s.JumpUsername = username
+		s.JumpPassword = password
+		s.JumpKeyPath = keyPath
+	}
+}
+
+// WithKeepalive sends an SSH keepalive every seconds seconds while connected.
+func WithKeepalive(seconds int) Option {
+	return func(s *Endpoint) { s.KeepaliveInterval = seconds }
+}
+
+// WithTLS switches to NETCONF over TLS on DefaultTLSPort; caFile may be empty to use the system roots,
+// certFile and keyFile give the client certificate for mutual TLS. Use WithPort afterwards for another port.
+func WithTLS(caFile, certFile, keyFile string) Option {
+	return func(s *Endpoint) {
+		s.Transport = "tls"
+		s.Port = DefaultTLSPort
+		s.TLSCAFile = caFile
+		s.TLSCertFile = certFile
+		s.TLSKeyFile = keyFile
+	}
+}
+
+// WithDialer runs the session over the stream returned by dial instead of SSH or TLS.
+func WithDialer(dial Dialer) Option {
+	return func(s *Endpoint) { s.Dialer = dial }
+}
+
+// WithSSHAlgorithms restricts the algorithms offered in the SSH handshake, see SSHAlgorithms.
+func WithSSHAlgorithms(algorithms SSHAlgorithms) Option {
+	return func(s *Endpoint) { s.Algorithms = algorithms }
+}
+
+// WithLogger sends the session's diagnostics to logger instead of slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Endpoint) { s.Logger = logger }
+}
+
+// WithWireLog copies the raw NETCONF traffic to w, for debugging interop problems.
+func WithWireLog(w io.Writer) Option {
+	return func(s *Endpoint) { s.WireLog = w }
+}
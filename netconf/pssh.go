@@ -0,0 +1,876 @@
+// Package netconf is a NETCONF over SSH client: it connects to a device, exchanges hellos, runs RPCs
+// with either end-of-message or chunked framing, and offers helpers to filter and format the replies.
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ErrChannelClosed is returned when the device has already closed the NETCONF channel, which some devices
+// do when the first request doesn't follow the hello quickly enough.
+var ErrChannelClosed = errors.New("device closed NETCONF channel after hello (possibly idle/negotiation timeout); send the first RPC sooner")
+
+// ErrSessionAbandoned is returned by Run once an earlier RPC gave up on its reply, after the RPC timeout or a
+// cancelled context: the session was closed then, and a new one is needed.
+var ErrSessionAbandoned = errors.New("session closed after an rpc reply was abandoned; reconnect to send further rpcs")
+
+// DefaultMaxHelloBytes is generous enough for devices advertising hundreds of YANG modules.
+const DefaultMaxHelloBytes = 4 << 20
+
+// Endpoint is a NETCONF session with a single device. Build one with NewEndpoint, then Connect, Run and Disconnect.
+type Endpoint struct {
+	Ip          string
+	Name        string
+	Username    string
+	Password    string
+	PrivKeyPath string
+	// KeyPassphrase decrypts PrivKeyPath when the key is passphrase-protected.
+	KeyPassphrase string
+	// UseAgent adds the keys held by the ssh-agent at $SSH_AUTH_SOCK to the auth methods.
+	UseAgent  bool
+	agentConn net.Conn
+	// KeyAlgorithms restricts the public-key signature algorithms offered, e.g. rsa-sha2-512,rsa-sha2-256.
+	// When empty, crypto/ssh picks rsa-sha2-256/512 for RSA keys if the server advertises them, falling back to ssh-rsa.
+	KeyAlgorithms []string
+	// Algorithms restricts the ciphers, key exchanges, MACs and host key algorithms of the SSH handshake,
+	// e.g. to LegacyAlgorithms for old devices; empty lists keep crypto/ssh's defaults.
+	Algorithms SSHAlgorithms
+	Port       string
+	SshOut     io.Reader
+	SshIn      io.WriteCloser
+	Timeout    int
+	// RPCTimeout bounds how long, in seconds, Run waits for a complete reply; 0 falls back to Timeout.
+	RPCTimeout   int
+	Client       *ssh.Client
+	Session      *ssh.Session
+	Capabilities string
+	StrictHello  bool
+
+	// ParsedCapabilities and RemoteSessionID are decoded from the server hello in Capabilities;
+	// they stay empty if the hello can't be parsed.
+	ParsedCapabilities []Capability
+	RemoteSessionID    string
+
+	// HostKeyPolicy is one of strict (the default), warn or ignore; keys are checked against KnownHostsPath,
+	// or ~/.ssh/known_hosts when it is empty.
+	HostKeyPolicy  string
+	KnownHostsPath string
+	// HostKeyCallback, when set, is used as-is and takes precedence over HostKeyPolicy,
+	// so embedders can plug in their own host key trust store.
+	HostKeyCallback ssh.HostKeyCallback
+
+	// MaxHelloBytes caps how much of the server hello is read before giving up; defaults to DefaultMaxHelloBytes.
+	MaxHelloBytes int
+
+	// FramingVersion is the negotiated framing, "1.0" (]]>]]> delimiter) or "1.1" (RFC 6242 chunked), set during cliLogin.
+	FramingVersion string
+	chunkReader    *bufio.Reader
+	// pending holds bytes read past the end of the previous ]]>]]> message.
+	pending []byte
+	// messageID is the last message-id given to an outgoing <rpc> without one.
+	messageID uint64
+	// answered holds the message-ids already replied to, so a device echoing one twice is caught.
+	answered map[string]bool
+	// queued holds notifications read while waiting for a reply, for Subscribe to deliver first.
+	queued []string
+
+	// NetconfCommand, when set, is executed with Session.Start instead of requesting the netconf subsystem.
+	NetconfCommand string
+
+	// RequestPty allocates a pseudo-terminal before starting NETCONF, for devices that refuse to start it otherwise.
+	RequestPty bool
+	PtyTerm    string
+	PtyWidth   int
+	PtyHeight  int
+
+	// JumpHost, as host:port, tunnels the connection through an SSH bastion, authenticated
+	// with JumpUsername and JumpPassword and/or JumpKeyPath; its host key is checked like the device's.
+	JumpHost     string
+	JumpUsername string
+	JumpPassword string
+	JumpKeyPath  string
+	jumpClient   *ssh.Client
+
+	// KeepaliveInterval, in seconds, sends an SSH keepalive that often once connected; 0 disables it.
+	KeepaliveInterval int
+	keepaliveStop     chan struct{}
+	keepaliveDone     chan struct{}
+	lost              atomic.Bool
+
+	// abandoned is set once a reply is given up on and the session closed under the read still waiting for it.
+	abandoned atomic.Bool
+
+	// Transport is "ssh" (the default) or "tls" for NETCONF over TLS (RFC 7589). With TLS the server certificate
+	// is verified against TLSCAFile, or the system roots when empty, and TLSCertFile/TLSKeyFile give the client
+	// certificate for mutual TLS. The host key policy "ignore" skips server certificate verification.
+	Transport   string
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+	tlsConn     *tls.Conn
+
+	// Dialer, when set, replaces the SSH and TLS transports: Connect runs the session over the stream it returns.
+	Dialer     Dialer
+	dialedConn io.ReadWriteCloser
+
+	// subscribed is set by Subscribe; from then on only the subscription reads from the session.
+	subscribed bool
+	closing    atomic.Bool
+
+	// Logger receives the session's diagnostics: debug for wire traffic, info for lifecycle, warn and error
+	// for problems. slog.Default() is used when it is nil.
+	Logger *slog.Logger
+
+	// WireLog, when set, receives a copy of every byte sent and received on the NETCONF channel, marked with
+	// its direction. SSH authentication happens below this layer; should Password appear in a payload it is masked.
+	WireLog io.Writer
+}
+
+// publicKeyFile loads the private key and, if algorithms is set, restricts the signature algorithms it offers.
+// Encrypted keys need a passphrase; a missing or wrong one is reported as an error rather than skipping the key.
+func publicKeyFile(file, passphrase string, algorithms []string) (ssh.AuthMethod, error) {
+	buffer, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key %s: %v", file, err)
+	}
+
+	var key ssh.Signer
+	if passphrase != "" {
+		key, err = ssh.ParsePrivateKeyWithPassphrase(buffer, []byte(passphrase))
+	} else {
+		key, err = ssh.ParsePrivateKey(buffer)
+	}
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		return nil, fmt.Errorf("key %s is encrypted; provide its passphrase with -key-passphrase", file)
+	}
+	if errors.Is(err, x509.IncorrectPasswordError) {
+		return nil, fmt.Errorf("wrong passphrase for key %s", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %v", file, err)
+	}
+
+	if len(algorithms) > 0 {
+		algSigner, ok := key.(ssh.AlgorithmSigner)
+		if !ok {
+			return nil, fmt.Errorf("key %s does not support selecting signature algorithms", file)
+		}
+		key, err = ssh.NewSignerWithAlgorithms(algSigner, algorithms)
+		if err != nil {
+			return nil, fmt.Errorf("key %s cannot be used with algorithms %v: %v", file, algorithms, err)
+		}
+	}
+	return ssh.PublicKeys(key), nil
+}
+
+// agentAuth dials the ssh-agent at socket and offers its keys for public-key auth.
+func agentAuth(socket string) (ssh.AuthMethod, net.Conn, error) {
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent at %s: %v", socket, err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn, nil
+}
+
+// Connect connects to the specified server and opens a session (Filling the Client and Session fields in Endpoint struct).
+func (s *Endpoint) Connect() error {
+	return s.ConnectContext(context.Background())
+}
+
+// ConnectContext is Connect, giving up with ctx.Err() when ctx is cancelled or its deadline passes.
+func (s *Endpoint) ConnectContext(ctx context.Context) error {
+	if err := validateNode(s); err != nil {
+		return err
+	}
+	if s.Dialer != nil {
+		return s.connectDialer(ctx)
+	}
+	if s.Transport == "tls" {
+		return s.connectTLS(ctx)
+	}
+
+	var err error
+	hostKeyCb := s.HostKeyCallback
+	if hostKeyCb == nil {
+		hostKeyCb, err = hostKeyCallback(s.HostKeyPolicy, s.KnownHostsPath, s.logger())
+		if err != nil {
+			return err
+		}
+	}
+
+	config := &ssh.ClientConfig{
+		HostKeyCallback: hostKeyCb,
+		Timeout:         time.Duration(s.Timeout) * time.Second,
+	}
+	s.Algorithms.apply(config)
+
+	config.User = s.Username
+
+	var authMethods []ssh.AuthMethod
+	if s.Password != "" {
+		authMethods = append(authMethods, ssh.Password(s.Password))
+	}
+
+	if s.PrivKeyPath != "" {
+		auth, err := publicKeyFile(s.PrivKeyPath, s.KeyPassphrase, s.KeyAlgorithms)
+		if err != nil {
+			return fmt.Errorf("%v:%v - %v", s.Ip, s.Port, err)
+		}
+		authMethods = append(authMethods, auth)
+	}
+
+	if s.UseAgent {
+		auth, conn, err := agentAuth(os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			s.logger().Warn("skipping agent auth", "error", err)
+		} else {
+			s.agentConn = conn
+			authMethods = append(authMethods, auth)
+		}
+	}
+
+	config.Auth = authMethods
+
+	addr := net.JoinHostPort(s.Ip, s.Port)
+	var conn net.Conn
+	if s.JumpHost != "" {
+		conn, err = s.dialJump(ctx, addr, hostKeyCb)
+	} else {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		s.closeAgent()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, err)
+	}
+
+	// the ssh handshake and the hello exchange don't take a context, closing the connection is what interrupts them
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// ssh.ClientConfig.Timeout only bounds ssh.Dial, so the handshake on our own connection gets a deadline too;
+	// a tunnelled connection doesn't support deadlines and stays bounded by ctx alone
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		s.closeAgent()
+		s.closeJump()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, err)
+	}
+	s.Client = ssh.NewClient(sshConn, chans, reqs)
+
+	if err := s.cliLogin(); err != nil {
+		s.Client.Close()
+		s.closeAgent()
+		s.closeJump()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if !stop() {
+		s.Client.Close()
+		s.closeAgent()
+		s.closeJump()
+		return ctx.Err()
+	}
+	s.startKeepalive()
+	s.logger().Info("connected", "transport", "ssh", "session-id", s.RemoteSessionID, "base-version", s.BaseVersion())
+	return nil
+}
+
+func (s *Endpoint) cliLogin() error {
+	var err error
+
+	s.Session, err = s.Client.NewSession()
+	if err != nil {
+		return fmt.Errorf("%v:%v - failure on Client.NewSession() - details: %w", s.Ip, s.Port, classifyChannelError(err))
+	}
+
+	s.SshIn, err = s.Session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("%v:%v - failed to get session stdin: %v", s.Ip, s.Port, err)
+	}
+	s.SshOut, err = s.Session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("%v:%v - failed to get session stdout: %v", s.Ip, s.Port, err)
+	}
+
+	if s.RequestPty {
+		term := s.PtyTerm
+		if term == "" {
+			term = "vt100"
+		}
+		width, height := s.PtyWidth, s.PtyHeight
+		if width <= 0 {
+			width = 80
+		}
+		if height <= 0 {
+			height = 24
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO: 0, // don't echo our own RPCs back into the reply stream
+		}
+		err = s.Session.RequestPty(term, height, width, modes)
+		if err != nil {
+			return fmt.Errorf("%v:%v - failed to request pty: %v", s.Ip, s.Port, err)
+		}
+	}
+
+	if s.NetconfCommand != "" {
+		// Legacy devices (e.g. older Junos) expose NETCONF through an exec command instead of the subsystem.
+		err = s.Session.Start(s.NetconfCommand)
+		if err != nil {
+			return fmt.Errorf("%v:%v - failed to start netconf command %q: %v", s.Ip, s.Port, s.NetconfCommand, err)
+		}
+	} else {
+		err = s.Session.RequestSubsystem("netconf")
+		if err != nil {
+			return fmt.Errorf("%v:%v - failed to request netconf subsystem: %w", s.Ip, s.Port, classifyChannelError(err))
+		}
+	}
+
+	return s.exchangeHello()
+}
+
+// exchangeHello sends our hello over SshIn and reads the server hello from SshOut; it is shared by every transport.
+func (s *Endpoint) exchangeHello() error {
+	s.tapWire()
+
+	helloMsg := `<?xml version="1.0" encoding="UTF-8"?>
+	<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+	  <capabilities>
+		<capability>urn:ietf:params:netconf:base:1.0</capability>
+		<capability>urn:ietf:params:netconf:base:1.1</capability>
+	  </capabilities>
+	</hello>]]>]]>`
+
+	_, err := s.SshIn.Write([]byte(helloMsg))
+	if err != nil {
+		return fmt.Errorf("%v:%v - failed to send hello message: %v", s.Ip, s.Port, err)
+	}
+
+	maxHello := s.MaxHelloBytes
+	if maxHello <= 0 {
+		maxHello = DefaultMaxHelloBytes
+	}
+
+	var responseBuf bytes.Buffer
+	buf := make([]byte, 1024)
+	idx := -1
+	for {
+		n, err := s.SshOut.Read(buf)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%v:%v - failed to read server hello: %v", s.Ip, s.Port, err)
+		}
+		if n > 0 {
+			scanned := responseBuf.Len()
+			responseBuf.Write(buf[:n])
+			if idx = delimiterIndex(responseBuf.Bytes(), scanned); idx >= 0 {
+				break
+			}
+			if responseBuf.Len() > maxHello {
+				return fmt.Errorf("%v:%v - server hello exceeded %d bytes", s.Ip, s.Port, maxHello)
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	s.Capabilities = responseBuf.String()
+	if idx >= 0 {
+		data := responseBuf.Bytes()
+		s.Capabilities = string(data[:idx])
+		if rest := bytes.TrimSpace(data[idx+len(eomDelimiter):]); len(rest) > 0 {
+			s.pending = bytes.Clone(data[idx+len(eomDelimiter):])
+		}
+	}
+	if banner, hello := splitBanner(s.Capabilities); strings.TrimSpace(banner) != "" {
+		s.logger().Debug("skipped text before the server hello", "text", banner)
+		s.Capabilities = hello
+	}
+	if hello, err := ParseHello(s.Capabilities); err == nil {
+		s.ParsedCapabilities = ParseCapabilities(hello.Capabilities)
+		s.RemoteSessionID = strings.TrimSpace(hello.SessionID)
+	}
+
+	if s.StrictHello {
+		if err := validateHello(s.Capabilities); err != nil {
+			return fmt.Errorf("%v:%v - %v", s.Ip, s.Port, err)
+		}
+	}
+
+	// both sides advertise base:1.1 (we always do), so chunked framing applies from here on (RFC 6242 section 4.1)
+	s.FramingVersion = "1.0"
+	if s.HasCapability(baseCapability11) {
+		s.FramingVersion = "1.1"
+	}
+
+	return nil
+}
+
+// Run executes the given cli command on the opened session.
+func (s *Endpoint) Run(arg string) (string, error) {
+	return s.RunContext(context.Background(), arg)
+}
+
+// RunContext is Run, returning ctx.Err() when ctx is done before the reply arrives. The session is closed in
+// that case, as the device may still be sending the abandoned reply.
+func (s *Endpoint) RunContext(ctx context.Context, arg string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := s.usable(); err != nil {
+		return "", err
+	}
+	// a write blocked on a full channel window only returns once the session goes away
+	stop := context.AfterFunc(ctx, s.closeSession)
+	defer stop()
+
+	arg, id := s.tagMessageID(arg)
+	// a caller-chosen id may be reused once its reply is in
+	delete(s.answered, id)
+	s.logger().Debug("sending rpc", "message-id", id, "bytes", len(arg))
+	reply, err := s.run(ctx, arg, id)
+	if err != nil && ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if err != nil && s.lost.Load() {
+		return "", fmt.Errorf("%v:%v - %w", s.Ip, s.Port, ErrConnectionLost)
+	}
+	s.logger().Debug("received reply", "message-id", id, "bytes", len(reply), "error", err)
+	return reply, err
+}
+
+// usable returns an error when the session can no longer take RPCs.
+func (s *Endpoint) usable() error {
+	if s.lost.Load() {
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, ErrConnectionLost)
+	}
+	if s.abandoned.Load() {
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, ErrSessionAbandoned)
+	}
+	if s.subscribed {
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, ErrSubscribed)
+	}
+	return nil
+}
+
+func (s *Endpoint) run(ctx context.Context, arg, id string) (string, error) {
+	if err := s.send(arg); err != nil {
+		return "", err
+	}
+	return s.readReply(ctx, id)
+}
+
+// send writes one message in the negotiated framing.
+func (s *Endpoint) send(arg string) error {
+	if s.FramingVersion == "1.1" {
+		return s.sendChunked(arg)
+	}
+
+	if !strings.Contains(arg, "]]>]]>") {
+		arg = arg + "]]>]]>"
+	}
+
+	_, err := s.SshIn.Write([]byte(arg))
+	if peerClosed(err) {
+		return ErrChannelClosed
+	}
+	if err != nil {
+		return fmt.Errorf("%v:%v - failed to send the rpc message: %v", s.Ip, s.Port, err)
+	}
+	return nil
+}
+
+// peerClosed reports whether a write failed because the device closed its end: io.EOF on an SSH channel,
+// io.ErrClosedPipe on an in-memory pipe, EPIPE or ECONNRESET on a socket.
+func peerClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
+
+func (s *Endpoint) sendChunked(arg string) error {
+	payload := strings.TrimSuffix(strings.TrimSpace(arg), "]]>]]>")
+
+	err := writeChunk(s.SshIn, []byte(payload))
+	if err == nil {
+		err = writeEndOfChunks(s.SshIn)
+	}
+	if peerClosed(err) {
+		return ErrChannelClosed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send the rpc message: %v", err)
+	}
+	return nil
+}
+
+// RunReader streams the RPC from r to the device in bounded buffers, so the payload is never held in memory as a whole.
+// The end-of-message delimiter is appended unless the stream already ends with it. An <rpc> without a message-id
+// is given one from the session counter, as Run does; a bare operation needs WrapRPCReader first.
+func (s *Endpoint) RunReader(r io.Reader) (string, error) {
+	if err := s.usable(); err != nil {
+		return "", err
+	}
+	br := bufio.NewReaderSize(r, peekSize)
+	head, err := br.Peek(peekSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", fmt.Errorf("failed to read the rpc payload: %v", err)
+	}
+	r = br
+	var id string
+	if name, start, end, ok := firstElement(head); ok && name == "rpc" {
+		var tag string
+		tag, id = s.tagMessageID(string(head[start:end]))
+		delete(s.answered, id)
+		prefix := string(head[:start]) + tag
+		if _, err := br.Discard(end); err != nil {
+			return "", fmt.Errorf("failed to read the rpc payload: %v", err)
+		}
+		r = io.MultiReader(strings.NewReader(prefix), br)
+	}
+
+	delimiter := []byte("]]>]]>")
+	buf := make([]byte, 32*1024)
+	// hold back a little more than the delimiter so it can be found (and, for 1.1, dropped) even with trailing whitespace
+	const tailSize = 64
+	tail := make([]byte, 0, tailSize+len(buf))
+	chunked := s.FramingVersion == "1.1"
+
+	send := func(p []byte) error {
+		var err error
+		if chunked {
+			err = writeChunk(s.SshIn, p)
+		} else if len(p) > 0 {
+			_, err = s.SshIn.Write(p)
+		}
+		if peerClosed(err) {
+			return ErrChannelClosed
+		}
+		if err != nil {
+			return fmt.Errorf("failed to send the rpc message: %v", err)
+		}
+		return nil
+	}
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			tail = append(tail, buf[:n]...)
+			if len(tail) > tailSize {
+				if sErr := send(tail[:len(tail)-tailSize]); sErr != nil {
+					return "", sErr
+				}
+				tail = append(tail[:0], tail[len(tail)-tailSize:]...)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read the rpc payload: %v", err)
+		}
+	}
+
+	trimmed := bytes.TrimRight(tail, " \t\r\n")
+	hasDelimiter := bytes.HasSuffix(trimmed, delimiter)
+	if chunked {
+		if hasDelimiter {
+			tail = trimmed[:len(trimmed)-len(delimiter)]
+		}
+		if err := send(tail); err != nil {
+			return "", err
+		}
+		if err := writeEndOfChunks(s.SshIn); err != nil {
+			return "", fmt.Errorf("failed to send the rpc message: %v", err)
+		}
+	} else {
+		if !hasDelimiter {
+			tail = append(tail, delimiter...)
+		}
+		if err := send(tail); err != nil {
+			return "", err
+		}
+	}
+
+	return s.readReply(context.Background(), id)
+}
+
+// readReply reads the reply to the RPC sent with message-id id and returns an *RPCError, along with the reply itself,
+// when it carries an error-severity rpc-error. Notifications read on the way are queued for Subscribe. A reply to
+// another or an already answered message-id is an ErrMessageIDMismatch; replies without a message-id are accepted,
+// since some devices leave it out of rpc-errors.
+func (s *Endpoint) readReply(ctx context.Context, id string) (string, error) {
+	var reply string
+	for {
+		var err error
+		reply, err = s.readMessageWithTimeout(ctx)
+		if err != nil {
+			return reply, err
+		}
+		if !isNotification(strings.TrimSpace(reply)) {
+			break
+		}
+		s.logger().Debug("queueing notification received while waiting for a reply", "message-id", id)
+		s.queued = append(s.queued, strings.TrimSpace(reply))
+	}
+	if err := s.checkReplyID(reply, id); err != nil {
+		// the reply to id is still on its way, or never coming, so later replies can't be matched up either
+		s.closeSession()
+		return reply, err
+	}
+	if rpcErr := replyError(reply); rpcErr != nil {
+		return reply, rpcErr
+	}
+	return reply, nil
+}
+
+// readMessageWithTimeout gives up on a reply that doesn't complete within the RPC timeout or before ctx is done.
+// The session is closed in that case, since the abandoned read only returns once the channel goes away and the
+// stream is out of sync anyway, and later RPCs fail with ErrSessionAbandoned.
+func (s *Endpoint) readMessageWithTimeout(ctx context.Context) (string, error) {
+	timeout := s.rpcTimeout()
+
+	type result struct {
+		reply string
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		reply, err := s.readMessage()
+		done <- result{reply, err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case res := <-done:
+		return res.reply, res.err
+	case <-expired:
+		// the read goroutine still owns the session until the close makes it return
+		s.abandoned.Store(true)
+		s.closeSession()
+		return "", fmt.Errorf("%v:%v - no complete reply received within %v: %w", s.Ip, s.Port, timeout, os.ErrDeadlineExceeded)
+	case <-ctx.Done():
+		s.abandoned.Store(true)
+		s.closeSession()
+		return "", ctx.Err()
+	}
+}
+
+// rpcTimeout is RPCTimeout, falling back to Timeout.
+func (s *Endpoint) rpcTimeout() time.Duration {
+	if s.RPCTimeout > 0 {
+		return time.Duration(s.RPCTimeout) * time.Second
+	}
+	return time.Duration(s.Timeout) * time.Second
+}
+
+func (s *Endpoint) closeSession() {
+	if s.Session != nil {
+		s.Session.Close()
+	}
+	if s.tlsConn != nil {
+		s.tlsConn.Close()
+	}
+	if s.dialedConn != nil {
+		s.dialedConn.Close()
+	}
+}
+
+// readMessage reads from the session until the end-of-message delimiter, or one chunked message under 1.1 framing.
+func (s *Endpoint) readMessage() (string, error) {
+	if s.FramingVersion == "1.1" {
+		if s.chunkReader == nil {
+			s.chunkReader = bufio.NewReader(s.SshOut)
+		}
+		return readChunkedMessage(s.chunkReader)
+	}
+
+	var responseBuf bytes.Buffer
+	responseBuf.Write(s.pending)
+	s.pending = nil
+	buf := make([]byte, 1024)
+	idx := delimiterIndex(responseBuf.Bytes(), 0)
+	for idx < 0 {
+		scanned := responseBuf.Len()
+		n, err := s.SshOut.Read(buf)
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("%v:%v - failed to read rpc reply: %v", s.Ip, s.Port, err)
+		}
+		if n > 0 {
+			responseBuf.Write(buf[:n])
+			idx = delimiterIndex(responseBuf.Bytes(), scanned)
+		}
+		if err == io.EOF && idx < 0 {
+			if len(bytes.TrimSpace(responseBuf.Bytes())) == 0 {
+				return "", ErrChannelClosed
+			}
+			return responseBuf.String(), fmt.Errorf("%v:%v - reply cut off after %d bytes: %w", s.Ip, s.Port, responseBuf.Len(), io.ErrUnexpectedEOF)
+		}
+	}
+
+	// keep whatever follows the delimiter, e.g. a notification arriving right behind a reply, for the next read
+	data := responseBuf.Bytes()
+	end := idx + len(eomDelimiter)
+	if rest := bytes.TrimSpace(data[end:]); len(rest) > 0 {
+		s.pending = bytes.Clone(data[end:])
+	}
+	return string(data[:idx]), nil
+}
+
+// MaxMessageSize returns the message size limit advertised by the device in bytes, or 0 when none is advertised.
+func (s *Endpoint) MaxMessageSize() int {
+	return maxMessageSize(s.Capabilities)
+}
+
+// SessionID returns the session-id the server hello assigned to this session, or 0 when it had none.
+func (s *Endpoint) SessionID() int {
+	id, err := strconv.Atoi(s.RemoteSessionID)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// BaseVersion returns the negotiated NETCONF base version, "1.1" when both sides advertise base:1.1 and replies
+// are chunk-framed, "1.0" otherwise, or "" before Connect.
+func (s *Endpoint) BaseVersion() string {
+	return s.FramingVersion
+}
+
+// SSHClient returns the SSH connection under the session once connected, nil for TLS or a Dialer. It is an escape
+// hatch for what the package doesn't wrap, such as an exec channel; leave closing it to Disconnect.
+func (s *Endpoint) SSHClient() *ssh.Client {
+	return s.Client
+}
+
+// Disconnect closes the ssh sessoin.
+func (s *Endpoint) Disconnect() {
+	s.stopKeepalive()
+	s.closing.Store(true)
+
+	closePayload := `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  		<close-session/>
+	</rpc>]]>]]>`
+	// the subscription goroutine owns the reads, so there is no waiting for the close-session reply
+	if !s.subscribed {
+		s.Run(closePayload)
+	}
+	s.closeSession()
+	if s.Client != nil {
+		s.Client.Close()
+	}
+	s.closeJump()
+	s.closeAgent()
+	s.logger().Info("disconnected")
+}
+
+func (s *Endpoint) closeAgent() {
+	if s.agentConn != nil {
+		s.agentConn.Close()
+		s.agentConn = nil
+	}
+}
+
+// validateAddress accepts an IPv4 or IPv6 address, optionally in brackets, or a hostname, which is left to the dialer to resolve.
+func validateAddress(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("no address provided")
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if strings.Contains(host, ":") || looksLikeIPv4(host) {
+		return fmt.Errorf("provided ip: %v - not a valid IPv4 or IPv6 address", addr)
+	}
+	return validateHostname(host)
+}
+
+// looksLikeIPv4 reports whether addr is made of digits and dots only, so it is meant as an IPv4 literal.
+func looksLikeIPv4(addr string) bool {
+	return strings.Trim(addr, "0123456789.") == ""
+}
+
+// validateHostname checks host against the RFC 1123 hostname syntax.
+func validateHostname(host string) error {
+	name := strings.TrimSuffix(host, ".")
+	if len(name) == 0 || len(name) > 253 {
+		return fmt.Errorf("provided host: %v - hostname length is invalid", host)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("provided host: %v - hostname label %q is empty or too long", host, label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("provided host: %v - hostname label %q cannot start or end with '-'", host, label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("provided host: %v - hostname includes invalid character %q", host, c)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateNode(s *Endpoint) error {
+	if s.Timeout <= 0 {
+		return fmt.Errorf("provided timeout: %v - timeout must be a positive number of seconds", s.Timeout)
+	}
+	if err := s.Algorithms.validate(); err != nil {
+		return err
+	}
+	if err := validateAddress(s.Ip); err != nil {
+		return err
+	}
+	if s.Transport != "" && s.Transport != "ssh" && s.Transport != "tls" {
+		return fmt.Errorf("provided transport: %v - must be ssh or tls", s.Transport)
+	}
+	s.Ip = strings.TrimSuffix(strings.TrimPrefix(s.Ip, "["), "]")
+	if _, err := strconv.Atoi(s.Port); err != nil {
+		s.logger().Warn("wrong port number, defaulting to 22", "port", s.Port)
+		s.Port = "22"
+	}
+
+	return nil
+}
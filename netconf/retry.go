@@ -0,0 +1,58 @@
+package netconf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// ConnectWithRetry calls ConnectContext up to attempts times, doubling the wait after each failure from backoff.
+// Only transport failures are retried; authentication, host key and configuration errors are returned at once,
+// as is the last error once the attempts run out.
+func (s *Endpoint) ConnectWithRetry(ctx context.Context, attempts int, backoff time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	wait := backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = s.ConnectContext(ctx)
+		if err == nil || attempt == attempts || !retryableConnectError(err) {
+			return err
+		}
+		s.logger().Debug("connect failed, retrying", "attempt", attempt, "attempts", attempts, "backoff", wait, "error", err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+// retryableConnectError reports whether err looks like a network blip rather than something a retry won't fix.
+func retryableConnectError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// crypto/ssh doesn't give authentication failures a type of their own
+	if strings.Contains(err.Error(), "unable to authenticate") {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// the device dropping the connection mid-handshake
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrChannelClosed)
+}
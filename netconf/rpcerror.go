@@ -0,0 +1,113 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// RPCError is an <rpc-error> returned by the device (RFC 6241 section 4.3).
+// Raw holds the whole rpc-reply so no detail is lost when only the first error is reported.
+type RPCError struct {
+	Type     string `xml:"error-type"`
+	Tag      string `xml:"error-tag"`
+	Severity string `xml:"error-severity"`
+	Message  string `xml:"error-message"`
+	Path     string `xml:"error-path"`
+	// SessionID is the error-info session-id, set on lock-denied to name the session holding the lock.
+	SessionID string `xml:"error-info>session-id"`
+	Raw       string `xml:"-"`
+}
+
+func (e *RPCError) Error() string {
+	msg := fmt.Sprintf("rpc-error: %s (type %s, severity %s)", e.Tag, e.Type, e.Severity)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Path != "" {
+		msg += " at " + e.Path
+	}
+	return msg
+}
+
+type rpcErrorReply struct {
+	XMLName xml.Name   `xml:"rpc-reply"`
+	Errors  []RPCError `xml:"rpc-error"`
+}
+
+// parseRPCErrors returns the rpc-error elements carried by reply, trimmed of surrounding whitespace.
+func parseRPCErrors(reply string) ([]RPCError, error) {
+	if idx := strings.Index(reply, "]]>]]>"); idx != -1 {
+		reply = reply[:idx]
+	}
+	if !strings.Contains(reply, "rpc-error") {
+		return nil, nil
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(reply))
+	decoder.CharsetReader = charset.NewReaderLabel
+	var parsed rpcErrorReply
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse reply: %v", err)
+	}
+
+	for i := range parsed.Errors {
+		e := &parsed.Errors[i]
+		e.Type = strings.TrimSpace(e.Type)
+		e.Tag = strings.TrimSpace(e.Tag)
+		e.Severity = strings.TrimSpace(e.Severity)
+		e.Message = strings.TrimSpace(e.Message)
+		e.Path = strings.TrimSpace(e.Path)
+		e.SessionID = strings.TrimSpace(e.SessionID)
+		e.Raw = reply
+	}
+	return parsed.Errors, nil
+}
+
+// replyError returns the first rpc-error with severity "error" in reply, or nil. Warnings alone don't fail the RPC,
+// and a reply that can't be parsed is left for the caller to deal with.
+func replyError(reply string) *RPCError {
+	errs, err := parseRPCErrors(reply)
+	if err != nil {
+		return nil
+	}
+	for i := range errs {
+		if errs[i].Severity == "error" {
+			return &errs[i]
+		}
+	}
+	return nil
+}
+
+// Summary renders every rpc-error of the reply e was taken from, one block per error with its type, tag,
+// severity, path and message, for showing to a person instead of the reply XML. Empty fields are left out.
+func (e *RPCError) Summary() string {
+	errs, err := parseRPCErrors(e.Raw)
+	if err != nil || len(errs) == 0 {
+		errs = []RPCError{*e}
+	}
+
+	var b strings.Builder
+	for i, re := range errs {
+		if len(errs) > 1 {
+			fmt.Fprintf(&b, "rpc-error %d of %d:\n", i+1, len(errs))
+		} else {
+			b.WriteString("rpc-error:\n")
+		}
+		for _, field := range []struct{ name, value string }{
+			{"type", re.Type},
+			{"tag", re.Tag},
+			{"severity", re.Severity},
+			{"path", re.Path},
+			{"message", re.Message},
+			{"session-id", re.SessionID},
+		} {
+			if field.value != "" {
+				fmt.Fprintf(&b, "  %-11s %s\n", field.name+":", field.value)
+			}
+		}
+	}
+	return b.String()
+}
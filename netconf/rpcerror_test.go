@@ -0,0 +1,36 @@
+package netconf
+
+import "testing"
+
+func TestRPCErrorSummary(t *testing.T) {
+	raw := `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` +
+		`<rpc-error><error-type>application</error-type><error-tag>invalid-value</error-tag>` +
+		`<error-severity>error</error-severity><error-path>/if:interfaces/if:interface[if:name='eth0']/if:mtu</error-path>` +
+		`<error-message xml:lang="en">MTU 90000 is out of range</error-message></rpc-error>` +
+		`<rpc-error><error-type>protocol</error-type><error-tag>operation-failed</error-tag>` +
+		`<error-severity>warning</error-severity></rpc-error></rpc-reply>`
+
+	e := replyError(raw)
+	if e == nil {
+		t.Fatal("replyError found no rpc-error")
+	}
+	want := "rpc-error 1 of 2:\n" +
+		"  type:       application\n" +
+		"  tag:        invalid-value\n" +
+		"  severity:   error\n" +
+		"  path:       /if:interfaces/if:interface[if:name='eth0']/if:mtu\n" +
+		"  message:    MTU 90000 is out of range\n" +
+		"rpc-error 2 of 2:\n" +
+		"  type:       protocol\n" +
+		"  tag:        operation-failed\n" +
+		"  severity:   warning\n"
+	if got := e.Summary(); got != want {
+		t.Errorf("Summary() =\n%s\nwant\n%s", got, want)
+	}
+
+	single := &RPCError{Type: "rpc", Tag: "lock-denied", Severity: "error", SessionID: "7"}
+	want = "rpc-error:\n  type:       rpc\n  tag:        lock-denied\n  severity:   error\n  session-id: 7\n"
+	if got := single.Summary(); got != want {
+		t.Errorf("Summary() without Raw =\n%s\nwant\n%s", got, want)
+	}
+}
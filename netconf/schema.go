@@ -0,0 +1,75 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MonitoringCapability is advertised by devices implementing ietf-netconf-monitoring (RFC 6022), which provides get-schema.
+const MonitoringCapability = "urn:ietf:params:xml:ns:yang:ietf-netconf-monitoring"
+
+// GetSchema downloads a schema the device implements with the RFC 6022 <get-schema> RPC and returns its text.
+// version may be empty for the device's default revision, format defaults to yang.
+func (s *Endpoint) GetSchema(identifier, version, format string) (string, error) {
+	if !s.HasCapability(MonitoringCapability) {
+		return "", fmt.Errorf("get-schema requires the %s capability, which the device does not advertise", MonitoringCapability)
+	}
+	if identifier == "" {
+		return "", fmt.Errorf("get-schema needs a schema identifier")
+	}
+	if format == "" {
+		format = "yang"
+	}
+
+	var op strings.Builder
+	fmt.Fprintf(&op, `<get-schema xmlns="%s"><identifier>%s</identifier>`, MonitoringCapability, escapeText(identifier))
+	if version != "" {
+		fmt.Fprintf(&op, "<version>%s</version>", escapeText(version))
+	}
+	fmt.Fprintf(&op, "<format>%s</format></get-schema>", escapeText(format))
+
+	reply, err := s.Run(rpcEnvelope(op.String()))
+	if err != nil {
+		return "", err
+	}
+	return schemaText(reply)
+}
+
+// schemaText returns the unescaped text content of the <data> element of a get-schema reply.
+func schemaText(reply string) (string, error) {
+	if idx := strings.Index(reply, "]]>]]>"); idx != -1 {
+		reply = reply[:idx]
+	}
+	decoder := xml.NewDecoder(strings.NewReader(reply))
+	var text strings.Builder
+	inData, found := false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse get-schema reply: %v", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "data" && !found {
+				inData, found = true, true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "data" {
+				inData = false
+			}
+		case xml.CharData:
+			if inData {
+				text.Write(t)
+			}
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("get-schema reply has no <data> element")
+	}
+	return strings.TrimSpace(text.String()) + "\n", nil
+}
@@ -0,0 +1,86 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ChannelErrorKind groups channel and subsystem failures by their likely cause.
+type ChannelErrorKind int
+
+const (
+	ChannelErrorOther ChannelErrorKind = iota
+	ChannelErrorProhibited
+	ChannelErrorResourceShortage
+	ChannelErrorConnectionFailed
+	ChannelErrorUnknownChannelType
+	ChannelErrorSubsystemRejected
+	ChannelErrorConnectionClosed
+)
+
+func (k ChannelErrorKind) String() string {
+	switch k {
+	case ChannelErrorProhibited:
+		return "channel open administratively prohibited"
+	case ChannelErrorResourceShortage:
+		return "channel open refused, device is out of resources (SSH channel/session limit reached?)"
+	case ChannelErrorConnectionFailed:
+		return "channel open failed"
+	case ChannelErrorUnknownChannelType:
+		return "channel type not supported by device"
+	case ChannelErrorSubsystemRejected:
+		return "netconf subsystem request rejected (NETCONF not enabled on this device/port?)"
+	case ChannelErrorConnectionClosed:
+		return "connection closed by device"
+	default:
+		return "session setup failed"
+	}
+}
+
+// ChannelError describes why opening the session channel or starting the netconf subsystem failed.
+type ChannelError struct {
+	Kind ChannelErrorKind
+	// Message is the reason text sent by the device, if any.
+	Message string
+	Err     error
+}
+
+func (e *ChannelError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%v: %v", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+// classifyChannelError maps errors from NewSession and RequestSubsystem onto a ChannelError.
+func classifyChannelError(err error) *ChannelError {
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		kind := ChannelErrorConnectionFailed
+		switch openErr.Reason {
+		case ssh.Prohibited:
+			kind = ChannelErrorProhibited
+		case ssh.ResourceShortage:
+			kind = ChannelErrorResourceShortage
+		case ssh.UnknownChannelType:
+			kind = ChannelErrorUnknownChannelType
+		}
+		return &ChannelError{Kind: kind, Message: openErr.Message, Err: err}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return &ChannelError{Kind: ChannelErrorConnectionClosed, Err: err}
+	}
+	if strings.Contains(err.Error(), "subsystem request failed") {
+		return &ChannelError{Kind: ChannelErrorSubsystemRejected, Err: err}
+	}
+	return &ChannelError{Kind: ChannelErrorOther, Err: err}
+}
@@ -0,0 +1,64 @@
+package netconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestClassifyChannelError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantKind    ChannelErrorKind
+		wantMessage string
+	}{
+		{"prohibited", &ssh.OpenChannelError{Reason: ssh.Prohibited, Message: "denied by policy"}, ChannelErrorProhibited, "denied by policy"},
+		{"resource shortage", &ssh.OpenChannelError{Reason: ssh.ResourceShortage, Message: "too many sessions"}, ChannelErrorResourceShortage, "too many sessions"},
+		{"unknown channel type", &ssh.OpenChannelError{Reason: ssh.UnknownChannelType}, ChannelErrorUnknownChannelType, ""},
+		{"connection failed", &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: "no route"}, ChannelErrorConnectionFailed, "no route"},
+		{"wrapped open error", fmt.Errorf("open: %w", &ssh.OpenChannelError{Reason: ssh.Prohibited}), ChannelErrorProhibited, ""},
+		{"subsystem rejected", errors.New("ssh: subsystem request failed"), ChannelErrorSubsystemRejected, ""},
+		{"closed", io.EOF, ChannelErrorConnectionClosed, ""},
+		{"other", errors.New("ssh: unexpected packet"), ChannelErrorOther, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyChannelError(tt.err)
+			if got.Kind != tt.wantKind || got.Message != tt.wantMessage {
+				t.Errorf("classifyChannelError(%v) = {%v, %q}, want {%v, %q}", tt.err, got.Kind, got.Message, tt.wantKind, tt.wantMessage)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("classifyChannelError(%v) does not wrap the original error", tt.err)
+			}
+		})
+	}
+}
+
+// TestConnectSubsystemRejected has the device refuse the netconf subsystem, as it does without a pty when
+// RequirePty is set, and checks Connect reports it as a ChannelError.
+func TestConnectSubsystemRejected(t *testing.T) {
+	f := netconftest.NewDevice()
+	f.RequirePty = true
+	port := listenSSH(t, f, nil)
+
+	s := NewEndpoint("127.0.0.1", WithPort(port), WithPassword("admin", "secret"), WithHostKeyPolicy("ignore", ""),
+		WithTimeout(5), WithLogger(quietLogger()))
+	err := s.Connect()
+	if err == nil {
+		s.Disconnect()
+		t.Fatal("Connect succeeded, want the subsystem request refused")
+	}
+	var chErr *ChannelError
+	if !errors.As(err, &chErr) || chErr.Kind != ChannelErrorSubsystemRejected {
+		t.Fatalf("Connect error = %v, want a ChannelError of kind ChannelErrorSubsystemRejected", err)
+	}
+	if !strings.Contains(err.Error(), "NETCONF not enabled") {
+		t.Errorf("Connect error = %v, want it to suggest NETCONF is not enabled", err)
+	}
+}
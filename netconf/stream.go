@@ -0,0 +1,127 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// streamHeadSize is how much of a streamed reply is kept to look for an rpc-error in.
+const streamHeadSize = 64 << 10
+
+// RunStream sends rpc and copies the reply to w as it arrives, without the framing, instead of returning it,
+// so a multi-megabyte get-config never has to fit in memory. In exchange the reply isn't correlated by
+// message-id, and rpc-errors are only reported as *RPCError for replies under 64 KiB, which covers any
+// real error reply; w has received the reply either way. The RPC timeout bounds the whole transfer.
+func (s *Endpoint) RunStream(rpc string, w io.Writer) error {
+	if err := s.usable(); err != nil {
+		return err
+	}
+	rpc, id := s.tagMessageID(rpc)
+	s.logger().Debug("sending rpc", "message-id", id, "bytes", len(rpc), "stream", true)
+	if err := s.send(rpc); err != nil {
+		return err
+	}
+
+	var expired atomic.Bool
+	if timeout := s.rpcTimeout(); timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			expired.Store(true)
+			s.closeSession()
+		})
+		defer timer.Stop()
+	}
+
+	head := &headBuffer{limit: streamHeadSize}
+	var n int64
+	var err error
+	if s.FramingVersion == "1.1" {
+		if s.chunkReader == nil {
+			s.chunkReader = bufio.NewReader(s.SshOut)
+		}
+		n, err = copyChunkedMessage(s.chunkReader, io.MultiWriter(w, head))
+	} else {
+		n, err = s.copyMessage(io.MultiWriter(w, head))
+	}
+	s.logger().Debug("received reply", "message-id", id, "bytes", n, "error", err, "stream", true)
+	if err != nil {
+		if expired.Load() {
+			return fmt.Errorf("%v:%v - no complete reply received within %v: %w", s.Ip, s.Port, s.rpcTimeout(), os.ErrDeadlineExceeded)
+		}
+		return err
+	}
+
+	if !head.truncated {
+		if rpcErr := replyError(head.String()); rpcErr != nil {
+			return rpcErr
+		}
+	}
+	return nil
+}
+
+// copyMessage copies one ]]>]]> framed message to w, less the delimiter, holding back only the few bytes that
+// could be the start of a delimiter split across reads.
+func (s *Endpoint) copyMessage(w io.Writer) (int64, error) {
+	var written int64
+	data := s.pending
+	s.pending = nil
+	buf := make([]byte, 32*1024)
+	for {
+		if idx := delimiterIndex(data, 0); idx >= 0 {
+			n, err := w.Write(data[:idx])
+			written += int64(n)
+			if rest := bytes.TrimSpace(data[idx+len(eomDelimiter):]); len(rest) > 0 {
+				s.pending = bytes.Clone(data[idx+len(eomDelimiter):])
+			}
+			return written, err
+		}
+
+		// everything but a possible partial delimiter at the end can go out now
+		if keep := len(eomDelimiter) - 1; len(data) > keep {
+			n, err := w.Write(data[:len(data)-keep])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			data = append(data[:0:0], data[len(data)-keep:]...)
+		}
+
+		n, err := s.SshOut.Read(buf)
+		data = append(data, buf[:n]...)
+		if err == io.EOF {
+			if written == 0 && len(bytes.TrimSpace(data)) == 0 {
+				return 0, ErrChannelClosed
+			}
+			// hand over what did arrive, but a reply without its delimiter is incomplete
+			n, werr := w.Write(data)
+			if werr != nil {
+				return written + int64(n), werr
+			}
+			return written + int64(n), fmt.Errorf("%v:%v - reply cut off after %d bytes: %w", s.Ip, s.Port, written+int64(n), io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return written, fmt.Errorf("%v:%v - failed to read rpc reply: %v", s.Ip, s.Port, err)
+		}
+	}
+}
+
+// headBuffer keeps the first limit bytes written to it.
+type headBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if h.Len()+len(p) > h.limit {
+		h.truncated = true
+	}
+	if room := h.limit - h.Len(); room > 0 {
+		h.Buffer.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,87 @@
+package netconf
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// DefaultTLSPort is the IANA port for NETCONF over TLS (RFC 7589).
+const DefaultTLSPort = "6513"
+
+// tlsConfig builds the client TLS configuration from the CA and client certificate files.
+func (s *Endpoint) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         s.Ip,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.HostKeyPolicy == "ignore",
+	}
+
+	if s.TLSCAFile != "" {
+		pem, err := os.ReadFile(s.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %v", s.TLSCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", s.TLSCAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// connectTLS dials the device over TLS and runs the same hello exchange as the SSH transport.
+func (s *Endpoint) connectTLS(ctx context.Context) error {
+	config, err := s.tlsConfig()
+	if err != nil {
+		return fmt.Errorf("%v:%v - %v", s.Ip, s.Port, err)
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: time.Duration(s.Timeout) * time.Second},
+		Config:    config,
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Ip, s.Port))
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%v:%v - %w", s.Ip, s.Port, err)
+	}
+	s.tlsConn = conn.(*tls.Conn)
+	s.SshIn = s.tlsConn
+	s.SshOut = s.tlsConn
+
+	// the hello exchange doesn't take a context, closing the connection is what interrupts it
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := s.exchangeHello(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	if !stop() {
+		conn.Close()
+		return ctx.Err()
+	}
+	s.logger().Info("connected", "transport", "tls", "session-id", s.RemoteSessionID, "base-version", s.BaseVersion())
+	return nil
+}
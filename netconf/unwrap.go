@@ -0,0 +1,56 @@
+package netconf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UnwrapReply returns the content inside <rpc-reply><data>, or inside <rpc-reply> when there is no <data>.
+// Replies carrying an <rpc-error> are not unwrapped so the error context is not lost.
+func UnwrapReply(reply string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(reply))
+
+	depth := 0
+	inReply := false
+	replyStart, dataStart := -1, -1
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse reply: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && t.Name.Local == "rpc-reply" {
+				inReply = true
+				replyStart = int(decoder.InputOffset())
+			} else if inReply && depth == 2 {
+				switch t.Name.Local {
+				case "rpc-error":
+					return "", fmt.Errorf("reply contains rpc-error")
+				case "data":
+					if dataStart == -1 {
+						dataStart = int(decoder.InputOffset())
+					}
+				}
+			}
+		case xml.EndElement:
+			if inReply && depth == 2 && t.Name.Local == "data" && dataStart != -1 {
+				return strings.TrimSpace(reply[dataStart:offset]), nil
+			}
+			if inReply && depth == 1 {
+				return strings.TrimSpace(reply[replyStart:offset]), nil
+			}
+			depth--
+		}
+	}
+
+	return "", fmt.Errorf("no <rpc-reply> element found in reply")
+}
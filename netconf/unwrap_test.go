@@ -0,0 +1,58 @@
+package netconf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnwrapReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "data reply",
+			reply: `<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data><system><hostname>r1</hostname></system></data></rpc-reply>`,
+			want:  `<system><hostname>r1</hostname></system>`,
+		},
+		{
+			name:  "ok reply without data",
+			reply: `<rpc-reply message-id="2" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`,
+			want:  `<ok/>`,
+		},
+		{
+			name:  "prefixed elements",
+			reply: `<nc:rpc-reply xmlns:nc="urn:ietf:params:xml:ns:netconf:base:1.0"><nc:data><x/></nc:data></nc:rpc-reply>`,
+			want:  `<x/>`,
+		},
+		{
+			name:    "error reply",
+			reply:   `<rpc-reply message-id="3" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + rpcErrorBody + `</rpc-reply>`,
+			wantErr: "reply contains rpc-error",
+		},
+		{
+			name:    "not a reply",
+			reply:   `<hello/>`,
+			wantErr: "no <rpc-reply> element found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnwrapReply(tt.reply)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("UnwrapReply error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnwrapReply: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UnwrapReply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
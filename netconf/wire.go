@@ -0,0 +1,61 @@
+package netconf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// wireLog mirrors the NETCONF traffic to a debug sink, with the Endpoint's password masked should it show up.
+type wireLog struct {
+	mu       sync.Mutex
+	w        io.Writer
+	password string
+}
+
+func (l *wireLog) record(direction string, p []byte) {
+	data := string(p)
+	if l.password != "" {
+		data = strings.ReplaceAll(data, l.password, "********")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, "%s %d bytes\n%s\n", direction, len(p), data)
+}
+
+type wireWriter struct {
+	io.WriteCloser
+	log *wireLog
+}
+
+func (w wireWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	if n > 0 {
+		w.log.record(">>> sent", p[:n])
+	}
+	return n, err
+}
+
+type wireReader struct {
+	io.Reader
+	log *wireLog
+}
+
+func (r wireReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.log.record("<<< received", p[:n])
+	}
+	return n, err
+}
+
+// tapWire wraps SshIn and SshOut so everything sent and received is copied to WireLog, when set.
+func (s *Endpoint) tapWire() {
+	if s.WireLog == nil {
+		return
+	}
+	l := &wireLog{w: s.WireLog, password: s.Password}
+	s.SshIn = wireWriter{WriteCloser: s.SshIn, log: l}
+	s.SshOut = wireReader{Reader: s.SshOut, log: l}
+}
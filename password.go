@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// resolvePassword fills config.Password from -password-env, or prompts for it when stdin is a terminal.
+func resolvePassword(config *Config) error {
+	if config.PasswordEnv != "" {
+		if config.Password != "" {
+			return fmt.Errorf("cannot specify both -password and -password-env; choose one")
+		}
+		config.Password = os.Getenv(config.PasswordEnv)
+		if config.Password == "" {
+			return fmt.Errorf("environment variable %s is empty or not set", config.PasswordEnv)
+		}
+		return nil
+	}
+	if !needsPassword(*config) {
+		return nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+
+	target := config.IP
+	if target == "" {
+		target = config.Devices + config.Group + config.ProbeSubnet
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s@%s: ", config.Username, target)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("failed to read password: %v", err)
+	}
+	config.Password = string(password)
+	return nil
+}
+
+// needsPassword reports whether the run still lacks credentials it would connect with: no password, key or
+// explicit -use-agent for an ssh connection that is actually made. The agent that is on by default whenever
+// $SSH_AUTH_SOCK is set doesn't count, since its keys may well not be accepted by a password-only device; the
+// prompted password is then offered alongside them.
+func needsPassword(config Config) bool {
+	if config.Password != "" || config.Key != "" || config.Transport == "tls" {
+		return false
+	}
+	if config.UseAgent && config.explicitFlags["use-agent"] {
+		return false
+	}
+	return config.CapabilitiesFrom == "" && !config.DryRun && hasTarget(config)
+}
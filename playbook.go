@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/naseriax/gonc/netconf"
+	"gopkg.in/yaml.v3"
+)
+
+// playbook is a -playbook file: steps run in order over one session, and what to do when one fails.
+//
+//	on-error: rollback
+//	steps:
+//	  - op: lock
+//	    datastore: candidate
+//	  - op: edit-config
+//	    datastore: candidate
+//	    file: interfaces.xml
+//	  - op: validate
+//	    datastore: candidate
+//	  - op: commit
+//	  - op: unlock
+//	    datastore: candidate
+type playbook struct {
+	// OnError is stop (the default), or rollback to discard the candidate and release the locks taken so far.
+	OnError string         `yaml:"on-error"`
+	Steps   []playbookStep `yaml:"steps"`
+}
+
+// playbookStep is one operation. Datastore and File are only read by the operations that take them; File is
+// relative to the playbook. Format overrides -format for the step's reply, raw printing it as received.
+type playbookStep struct {
+	Name             string `yaml:"name"`
+	Op               string `yaml:"op"`
+	Datastore        string `yaml:"datastore"`
+	File             string `yaml:"file"`
+	DefaultOperation string `yaml:"default-operation"`
+	Format           string `yaml:"format"`
+}
+
+// playbookOps are the operations a step may name, each mapped to the Endpoint method of the same name;
+// rpc sends the File payload as-is and get-config uses File, when given, as the subtree filter.
+var playbookOps = []string{"lock", "unlock", "edit-config", "validate", "commit", "discard-changes", "get-config", "rpc"}
+
+// stepResult is the outcome of one playbook step, or of one rollback action.
+type stepResult struct {
+	Step   string
+	Status string // ok, failed or skipped
+	Err    error
+}
+
+func loadPlaybook(path string) (*playbook, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open playbook %s: %v", path, err)
+	}
+	defer f.Close()
+
+	var play playbook
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&play); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse playbook %s: %v", path, err)
+	}
+
+	switch play.OnError {
+	case "":
+		play.OnError = "stop"
+	case "stop", "rollback":
+	default:
+		return nil, fmt.Errorf("playbook %s: unknown on-error %q; use stop or rollback", path, play.OnError)
+	}
+	if len(play.Steps) == 0 {
+		return nil, fmt.Errorf("playbook %s has no steps", path)
+	}
+	for i := range play.Steps {
+		step := &play.Steps[i]
+		if err := checkPlaybookStep(*step); err != nil {
+			return nil, fmt.Errorf("playbook %s: step %d: %v", path, i+1, err)
+		}
+		if step.File != "" && !filepath.IsAbs(step.File) {
+			step.File = filepath.Join(filepath.Dir(path), step.File)
+		}
+	}
+	return &play, nil
+}
+
+func checkPlaybookStep(step playbookStep) error {
+	switch step.Format {
+	case "", "xml", "json", "yaml", "raw":
+	default:
+		return fmt.Errorf("unknown format %q; use xml, json, yaml or raw", step.Format)
+	}
+	switch step.Op {
+	case "lock", "unlock", "validate", "get-config":
+		if step.Datastore == "" {
+			return fmt.Errorf("%s needs a datastore", step.Op)
+		}
+	case "edit-config":
+		if step.Datastore == "" || step.File == "" {
+			return fmt.Errorf("edit-config needs a datastore and a file")
+		}
+	case "rpc":
+		if step.File == "" {
+			return fmt.Errorf("rpc needs a file")
+		}
+	case "commit", "discard-changes":
+	case "":
+		return fmt.Errorf("no op given; use one of %s", strings.Join(playbookOps, ", "))
+	default:
+		return fmt.Errorf("unknown op %q; use one of %s", step.Op, strings.Join(playbookOps, ", "))
+	}
+	return nil
+}
+
+// label names the step in the report: its name, or the op and datastore.
+func (step playbookStep) label() string {
+	if step.Name != "" {
+		return step.Name
+	}
+	if step.Datastore != "" {
+		return step.Op + " " + step.Datastore
+	}
+	return step.Op
+}
+
+// runPlaybook connects and runs -playbook; see executePlaybook.
+func runPlaybook(config Config) ([]stepResult, string, error) {
+	play, err := loadPlaybook(config.Playbook)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ncEndPoint := newEndpoint(config)
+	if err := ncEndPoint.ConnectWithRetry(context.Background(), config.Retries+1, config.RetryBackoff); err != nil {
+		return nil, "", err
+	}
+	defer ncEndPoint.Disconnect()
+	return executePlaybook(config, ncEndPoint, play)
+}
+
+// executePlaybook runs the steps in order and returns the status of each, plus the replies of the get-config
+// and rpc steps. Once a step fails the rest are skipped; with on-error rollback the candidate is discarded if
+// it was edited, and the datastores the playbook locked are unlocked, most recent first. A failure is reported
+// as a *stepsFailedError.
+func executePlaybook(config Config, s *netconf.Endpoint, play *playbook) ([]stepResult, string, error) {
+	var results []stepResult
+	var outputs []string
+	var locked []string
+	editedCandidate := false
+
+	var failed *stepResult
+	for _, step := range play.Steps {
+		if failed != nil {
+			results = append(results, stepResult{Step: step.label(), Status: "skipped"})
+			continue
+		}
+
+		reply, err := runPlaybookStep(config, s, step)
+		if step.Op == "edit-config" && step.Datastore == "candidate" {
+			// a failed edit-config may still have changed part of the candidate
+			editedCandidate = true
+		}
+		if err == nil && reply != "" {
+			reply, err = formatStepReply(config, step, reply, s.FramingVersion)
+			if err == nil {
+				outputs = append(outputs, reply)
+			}
+		}
+		if err != nil {
+			failed = &stepResult{Step: step.label(), Status: "failed", Err: err}
+			results = append(results, *failed)
+			continue
+		}
+		results = append(results, stepResult{Step: step.label(), Status: "ok"})
+
+		switch step.Op {
+		case "lock":
+			locked = append(locked, step.Datastore)
+		case "unlock":
+			locked = removeLast(locked, step.Datastore)
+		case "commit", "discard-changes":
+			editedCandidate = false
+		}
+	}
+
+	if failed == nil {
+		return results, strings.Join(outputs, "\n"), nil
+	}
+	stepsErr := &stepsFailedError{Failed: []string{fmt.Sprintf("%s: %v", failed.Step, failed.Err)}, Total: len(play.Steps)}
+	if exitCode(failed.Err) == exitRPCError {
+		stepsErr.RPCErrors = 1
+	}
+
+	if play.OnError == "rollback" {
+		rollback := func(action string, err error) {
+			r := stepResult{Step: "rollback: " + action, Status: "ok", Err: err}
+			if err != nil {
+				r.Status = "failed"
+				stepsErr.Failed = append(stepsErr.Failed, fmt.Sprintf("%s: %v", r.Step, err))
+			}
+			results = append(results, r)
+		}
+		if editedCandidate {
+			rollback("discard-changes", s.DiscardChanges())
+		}
+		for i := len(locked) - 1; i >= 0; i-- {
+			rollback("unlock "+locked[i], s.Unlock(locked[i]))
+		}
+	}
+	return results, strings.Join(outputs, "\n"), stepsErr
+}
+
+// formatStepReply renders a step's reply in the step's format, falling back to -format.
+func formatStepReply(config Config, step playbookStep, reply, framing string) (string, error) {
+	if step.Format == "raw" {
+		return reply, nil
+	}
+	reply, err := processReply(config, reply, framing)
+	if err != nil {
+		return "", err
+	}
+	if step.Format != "" {
+		config.Format = step.Format
+	}
+	return convertOutput(config, reply)
+}
+
+// removeLast returns list without its last occurrence of v.
+func removeLast(list []string, v string) []string {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == v {
+			return append(list[:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// runPlaybookStep runs one step and returns the reply worth printing, "" for the steps that only answer <ok/>.
+func runPlaybookStep(config Config, s *netconf.Endpoint, step playbookStep) (string, error) {
+	var payload string
+	if step.File != "" {
+		data, err := os.ReadFile(step.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %v", step.File, err)
+		}
+		payload = strings.TrimSpace(string(data))
+	}
+
+	switch step.Op {
+	case "lock":
+		return "", s.Lock(step.Datastore)
+	case "unlock":
+		return "", s.Unlock(step.Datastore)
+	case "edit-config":
+		_, err := s.EditConfig(step.Datastore, payload, netconf.EditConfigOptions{DefaultOperation: step.DefaultOperation})
+		return "", err
+	case "validate":
+		_, err := s.Validate(step.Datastore)
+		return "", err
+	case "commit":
+		return "", s.Commit()
+	case "discard-changes":
+		return "", s.DiscardChanges()
+	case "get-config":
+		return s.GetConfig(step.Datastore, payload)
+	default: // rpc
+		if !config.NoWrap {
+			var err error
+			if payload, err = netconf.WrapRPC(payload); err != nil {
+				return "", err
+			}
+		}
+		return s.Run(payload)
+	}
+}
+
+// formatPlaybookReport renders one line per step, and per rollback action, with its status.
+func formatPlaybookReport(results []stepResult) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tSTATUS\tRESULT")
+	ok, steps := 0, 0
+	for _, r := range results {
+		name := r.Step
+		if !strings.HasPrefix(name, "rollback: ") {
+			steps++
+			name = fmt.Sprintf("%d. %s", steps, name)
+			if r.Status == "ok" {
+				ok++
+			}
+		}
+		detail := ""
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, strings.ToUpper(r.Status), detail)
+	}
+	w.Flush()
+	fmt.Fprintf(&b, "%d of %d steps succeeded\n", ok, steps)
+	return b.String()
+}
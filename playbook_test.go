@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+const (
+	candidateCapability = "urn:ietf:params:netconf:capability:candidate:1.0"
+	validateCapability  = "urn:ietf:params:netconf:capability:validate:1.1"
+)
+
+func writePlaybook(t *testing.T, play string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "interfaces.xml"), []byte(`<interfaces xmlns="urn:example"><interface><name>eth0</name></interface></interfaces>`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "play.yaml")
+	if err := os.WriteFile(path, []byte(play), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const changePlaybook = `
+on-error: %s
+steps:
+  - op: lock
+    datastore: candidate
+  - op: edit-config
+    datastore: candidate
+    file: interfaces.xml
+  - op: validate
+    datastore: candidate
+  - op: commit
+  - op: unlock
+    datastore: candidate
+`
+
+func TestExecutePlaybook(t *testing.T) {
+	tests := []struct {
+		name         string
+		onError      string
+		failOn       string // element of the rpc the device rejects, none when empty
+		wantStatuses []string
+		wantRPCs     []string
+	}{
+		{
+			name:         "all steps succeed",
+			onError:      "rollback",
+			wantStatuses: []string{"ok", "ok", "ok", "ok", "ok"},
+			wantRPCs:     []string{"<lock>", "<edit-config>", "<validate>", "<commit/>", "<unlock>"},
+		},
+		{
+			name:         "failing validate rolls back",
+			onError:      "rollback",
+			failOn:       "<validate>",
+			wantStatuses: []string{"ok", "ok", "failed", "skipped", "skipped", "ok", "ok"},
+			wantRPCs:     []string{"<lock>", "<edit-config>", "<validate>", "<discard-changes/>", "<unlock>"},
+		},
+		{
+			name:         "failing edit-config rolls back",
+			onError:      "rollback",
+			failOn:       "<edit-config>",
+			wantStatuses: []string{"ok", "failed", "skipped", "skipped", "skipped", "ok", "ok"},
+			wantRPCs:     []string{"<lock>", "<edit-config>", "<discard-changes/>", "<unlock>"},
+		},
+		{
+			name:         "failing commit stops without rollback",
+			onError:      "stop",
+			failOn:       "<commit/>",
+			wantStatuses: []string{"ok", "ok", "ok", "failed", "skipped"},
+			wantRPCs:     []string{"<lock>", "<edit-config>", "<validate>", "<commit/>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			play, err := loadPlaybook(writePlaybook(t, strings.Replace(changePlaybook, "%s", tt.onError, 1)))
+			if err != nil {
+				t.Fatalf("loadPlaybook: %v", err)
+			}
+
+			d := netconftest.NewDevice(netconftest.Base10, netconftest.Base11, candidateCapability, validateCapability)
+			d.Handle = func(rpc string) []string {
+				if tt.failOn != "" && strings.Contains(rpc, tt.failOn) {
+					return []string{netconftest.Reply(rpc, netconftest.RPCError("operation-failed", "rejected"))}
+				}
+				return nil
+			}
+			s := connectFakeDevice(t, d)
+
+			results, _, err := executePlaybook(validConfig(func(*Config) {}), s, play)
+			var statuses []string
+			for _, r := range results {
+				statuses = append(statuses, r.Status)
+			}
+			if strings.Join(statuses, ",") != strings.Join(tt.wantStatuses, ",") {
+				t.Errorf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+
+			var stepsErr *stepsFailedError
+			if tt.failOn == "" {
+				if err != nil {
+					t.Fatalf("executePlaybook: %v", err)
+				}
+			} else if !errors.As(err, &stepsErr) || exitCode(err) != exitRPCError {
+				t.Fatalf("executePlaybook error = %v, want a stepsFailedError for an rpc-error", err)
+			}
+
+			requests := d.Requests()
+			if len(requests) != len(tt.wantRPCs) {
+				t.Fatalf("device received %d rpcs, want %d (%v)", len(requests), len(tt.wantRPCs), tt.wantRPCs)
+			}
+			for i, want := range tt.wantRPCs {
+				if !strings.Contains(requests[i], want) {
+					t.Errorf("rpc %d = %q, want %s", i+1, requests[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatPlaybookReport(t *testing.T) {
+	report := formatPlaybookReport([]stepResult{
+		{Step: "lock candidate", Status: "ok"},
+		{Step: "validate candidate", Status: "failed", Err: errors.New("rejected")},
+		{Step: "commit", Status: "skipped"},
+		{Step: "rollback: unlock candidate", Status: "ok"},
+	})
+	for _, want := range []string{"1. lock candidate", "FAILED   rejected", "3. commit", "rollback: unlock candidate", "1 of 3 steps succeeded"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestLoadPlaybookRejectsBadSteps(t *testing.T) {
+	tests := map[string]string{
+		"unknown op":             "steps:\n  - op: reboot\n",
+		"edit-config no file":    "steps:\n  - op: edit-config\n    datastore: candidate\n",
+		"lock without datastore": "steps:\n  - op: lock\n",
+		"unknown on-error":       "on-error: retry\nsteps:\n  - op: commit\n",
+		"unknown field":          "steps:\n  - op: commit\n    target: candidate\n",
+		"unknown format":         "steps:\n  - op: get-config\n    datastore: running\n    format: csv\n",
+		"no steps":               "on-error: stop\n",
+	}
+	for name, play := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadPlaybook(writePlaybook(t, play)); err == nil {
+				t.Fatal("loadPlaybook accepted an invalid playbook")
+			}
+		})
+	}
+}
+
+func TestExecutePlaybookStepFormats(t *testing.T) {
+	play, err := loadPlaybook(writePlaybook(t, `
+steps:
+  - op: get-config
+    datastore: running
+    format: json
+  - op: rpc
+    file: interfaces.xml
+    format: raw
+  - op: get-config
+    datastore: running
+`))
+	if err != nil {
+		t.Fatalf("loadPlaybook: %v", err)
+	}
+
+	const data = `<data><interfaces xmlns="urn:example"><interface><name>eth0</name></interface></interfaces></data>`
+	d := netconftest.NewDevice()
+	d.Handle = func(rpc string) []string {
+		if strings.Contains(rpc, "<get-config>") {
+			return []string{netconftest.Reply(rpc, data)}
+		}
+		return nil
+	}
+	s := connectFakeDevice(t, d)
+
+	_, output, err := executePlaybook(validConfig(func(c *Config) { c.Format = "yaml" }), s, play)
+	if err != nil {
+		t.Fatalf("executePlaybook: %v", err)
+	}
+	for _, want := range []string{
+		`"name": "eth0"`, // step 1 as json
+		`<rpc-reply message-id="2" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`, // step 2 raw
+		"name: eth0", // step 3 falls back to -format yaml
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// maxProbeHosts bounds -probe-subnet so a mistyped prefix length doesn't start a sweep of millions of addresses.
+const maxProbeHosts = 65536
+
+// probeResult is what the hello of one probed address revealed, or why there was none.
+type probeResult struct {
+	IP           string   `json:"ip"`
+	Vendor       string   `json:"vendor,omitempty"`
+	Framing      string   `json:"framing,omitempty"`
+	SessionID    string   `json:"session-id,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// vendorPrefixes maps capability URI prefixes to the vendor whose YANG modules or extensions they name.
+var vendorPrefixes = []struct {
+	prefix string
+	vendor string
+}{
+	{"http://cisco.com/", "Cisco"},
+	{"urn:ios", "Cisco"},
+	{"http://xml.juniper.net/", "Juniper"},
+	{"urn:nokia.com:", "Nokia"},
+	{"urn:alcatel-lucent.com:", "Nokia"},
+	{"urn:huawei:", "Huawei"},
+	{"http://www.huawei.com/", "Huawei"},
+	{"http://arista.com/", "Arista"},
+	{"http://www.ciena.com/", "Ciena"},
+	{"urn:ciena:", "Ciena"},
+	{"http://www.hp.com/", "HPE"},
+	{"urn:ericsson:", "Ericsson"},
+}
+
+// detectVendor names the vendor of the first capability with a known vendor prefix, "" when none has one.
+func detectVendor(caps []netconf.Capability) string {
+	for _, c := range caps {
+		for _, v := range vendorPrefixes {
+			if strings.HasPrefix(c.URI, v.prefix) {
+				return v.vendor
+			}
+		}
+	}
+	return ""
+}
+
+// probeHosts lists the addresses of prefix, leaving out the network and broadcast addresses of an IPv4 subnet.
+func probeHosts(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -probe-subnet %q: %v", cidr, err)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 {
+		return nil, fmt.Errorf("-probe-subnet %s has more than %d addresses; split it into smaller ranges", cidr, maxProbeHosts)
+	}
+
+	var hosts []string
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr.String())
+	}
+	if prefix.Addr().Is4() && hostBits >= 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// runProbe connects to every address of -probe-subnet with at most -concurrency sessions at a time, spending
+// no more than -probe-timeout on each, and returns what each hello revealed. Only the hello is exchanged.
+func runProbe(config Config) ([]probeResult, error) {
+	hosts, err := probeHosts(config.ProbeSubnet)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]probeResult, len(hosts))
+	sem := make(chan struct{}, config.Concurrency)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = probeHost(config, host)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+func probeHost(config Config, host string) probeResult {
+	config.IP = host
+	applyConfigFile(&config, host, "")
+	// the close-session on the way out is bounded too, or a host that hangs after its hello holds the sweep up
+	// for the full RPC timeout
+	config.Timeout, config.RPCTimeout = config.ProbeTimeout, config.ProbeTimeout
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.ProbeTimeout)*time.Second)
+	defer cancel()
+
+	ncEndPoint := newEndpoint(config)
+	if err := ncEndPoint.ConnectContext(ctx); err != nil {
+		return probeResult{IP: host, Error: err.Error()}
+	}
+	defer ncEndPoint.Disconnect()
+
+	return probeResult{
+		IP:           host,
+		Vendor:       detectVendor(ncEndPoint.ParsedCapabilities),
+		Framing:      ncEndPoint.BaseVersion(),
+		SessionID:    ncEndPoint.RemoteSessionID,
+		Capabilities: ncEndPoint.CapabilityURIs(),
+	}
+}
+
+// formatProbe renders the probe results: a table of the addresses that answered, or with -format json,
+// every address with its full capability list.
+func formatProbe(config Config, results []probeResult) (string, error) {
+	if config.Format == "json" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tVENDOR\tFRAMING\tSESSION-ID\tCAPABILITIES")
+	found := 0
+	for _, r := range results {
+		if r.Error != "" {
+			logger.Debug("no NETCONF hello", "host", r.IP, "error", r.Error)
+			continue
+		}
+		found++
+		vendor := r.Vendor
+		if vendor == "" {
+			vendor = "unknown"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", r.IP, vendor, r.Framing, r.SessionID, len(r.Capabilities))
+	}
+	w.Flush()
+	fmt.Fprintf(&b, "%d of %d addresses answered with a NETCONF hello\n", found, len(results))
+	return b.String(), nil
+}
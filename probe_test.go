@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naseriax/gonc/netconf/netconftest"
+)
+
+func TestProbeHosts(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		want    []string
+		wantErr bool
+	}{
+		{"192.0.2.0/30", []string{"192.0.2.1", "192.0.2.2"}, false},
+		{"192.0.2.9/30", []string{"192.0.2.9", "192.0.2.10"}, false},
+		{"192.0.2.4/31", []string{"192.0.2.4", "192.0.2.5"}, false},
+		{"192.0.2.7/32", []string{"192.0.2.7"}, false},
+		{"2001:db8::/126", []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}, false},
+		{"10.0.0.0/8", nil, true},
+		{"not-a-subnet", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			got, err := probeHosts(tt.cidr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("probeHosts(%s) = %v, want an error", tt.cidr, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("probeHosts: %v", err)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("probeHosts(%s) = %v, want %v", tt.cidr, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunProbe sweeps 127.0.0.0/29 with fake devices listening on two of its six addresses.
+func TestRunProbe(t *testing.T) {
+	generic := netconftest.NewDevice()
+	ln, port, err := generic.ListenTLS("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	juniper := netconftest.NewDevice(netconftest.Base10, "http://xml.juniper.net/netconf/junos/1.0")
+	juniper.SessionID = "7"
+	ln2, _, err := juniper.ListenTLS("127.0.0.2:" + port)
+	if err != nil {
+		t.Skipf("cannot listen on a second loopback address: %v", err)
+	}
+	defer ln2.Close()
+
+	config := validConfig(func(c *Config) {
+		c.IP, c.File = "", ""
+		c.ProbeSubnet = "127.0.0.0/29"
+		c.Transport, c.Insecure, c.Port = "tls", true, port
+		c.Concurrency, c.ProbeTimeout = 3, 2
+	})
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("validateConfig: %v", err)
+	}
+	captureLog(t)
+
+	results, err := runProbe(config)
+	if err != nil {
+		t.Fatalf("runProbe: %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("probed %d addresses, want 6", len(results))
+	}
+	answered := map[string]probeResult{}
+	for _, r := range results {
+		if r.Error == "" {
+			answered[r.IP] = r
+		}
+	}
+	if len(answered) != 2 {
+		t.Fatalf("%d addresses answered, want 2: %+v", len(answered), results)
+	}
+	if r := answered["127.0.0.1"]; r.Framing != "1.1" || r.Vendor != "" || r.SessionID != "42" {
+		t.Errorf("127.0.0.1 = %+v, want an unknown vendor on 1.1 framing with session-id 42", r)
+	}
+	if r := answered["127.0.0.2"]; r.Framing != "1.0" || r.Vendor != "Juniper" || len(r.Capabilities) != 2 {
+		t.Errorf("127.0.0.2 = %+v, want Juniper on 1.0 framing with 2 capabilities", r)
+	}
+
+	report, err := formatProbe(config, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"127.0.0.2  Juniper", "2 of 6 addresses answered"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+// TestProbeHostBoundsDisconnect probes a device that answers hello but never answers close-session: the probe
+// gives up on it within -probe-timeout, not the much longer -rpc-timeout.
+func TestProbeHostBoundsDisconnect(t *testing.T) {
+	d := netconftest.NewDevice()
+	d.IgnoreCloseSession = true
+	config := validConfig(func(c *Config) {
+		c.IP, c.File = "", ""
+		c.Transport, c.Insecure, c.Port = "tls", true, listenFakeDevice(t, d)
+		c.ProbeTimeout, c.RPCTimeout = 1, 120
+	})
+	captureLog(t)
+
+	start := time.Now()
+	r := probeHost(config, "127.0.0.1")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("probeHost took %v, want it bounded by the 1s -probe-timeout", elapsed)
+	}
+	if r.Error != "" || r.SessionID != "42" {
+		t.Errorf("probeHost = %+v, want the hello's session-id 42", r)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// rpcFiles expands -file into its paths: a comma-separated list whose entries may be globs,
+// each glob's matches in lexical order.
+func rpcFiles(spec string) ([]string, error) {
+	var files []string
+	for _, pattern := range splitList(spec) {
+		if !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -file pattern %q: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("-file pattern %q matches no files", pattern)
+		}
+		slices.Sort(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// multiFile reports whether -file names more than a single file.
+func multiFile(config Config) bool {
+	return strings.Contains(config.File, ",") || strings.ContainsAny(config.File, "*?[")
+}
+
+// outputIsDir reports whether -output names a directory, to receive one reply file per -file input.
+func outputIsDir(config Config) bool {
+	if config.Output == "" {
+		return false
+	}
+	if strings.HasSuffix(config.Output, string(os.PathSeparator)) {
+		return true
+	}
+	info, err := os.Stat(config.Output)
+	return err == nil && info.IsDir()
+}
+
+// replyFileName derives the output file for an input file, e.g. rpcs/01-lock.xml -> 01-lock.reply.xml.
+func replyFileName(input, format string) string {
+	base := filepath.Base(input)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".reply." + format
+}
+
+// stepsFailedError reports the steps that failed with -continue-on-error; the replies of the others are still written.
+type stepsFailedError struct {
+	Failed    []string
+	Total     int
+	RPCErrors int // how many of Failed were rejected by the device with an rpc-error
+}
+
+func (e *stepsFailedError) Error() string {
+	return fmt.Sprintf("%d of %d steps failed: %s", len(e.Failed), e.Total, strings.Join(e.Failed, "; "))
+}
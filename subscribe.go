@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/naseriax/gonc/netconf"
+)
+
+// runSubscription subscribes to config.Subscribe and prints each notification to stdout until interrupted.
+func runSubscription(config Config) error {
+	ncEndPoint := newEndpoint(config)
+	if err := ncEndPoint.ConnectWithRetry(context.Background(), config.Retries+1, config.RetryBackoff); err != nil {
+		return err
+	}
+	defer ncEndPoint.Disconnect()
+
+	notifications, err := ncEndPoint.Subscribe(config.Subscribe, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	indent := xmlIndent(config)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n, ok := <-notifications:
+			if !ok {
+				return fmt.Errorf("device ended the subscription")
+			}
+			fmt.Println(netconf.FormatXMLIndent(n, indent))
+		}
+	}
+}
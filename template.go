@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateData is passed to edit-config templates. Row is the first row of the batch, so
+// single-row templates can use {{.Row.name}} while batched ones range over {{.Rows}}.
+type templateData struct {
+	Row  map[string]string
+	Rows []map[string]string
+}
+
+// readCSVRows reads a CSV file whose first line is the header naming the template variables.
+func readCSVRows(path string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV file %s: %v", path, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("CSV file %s needs a header line and at least one row", path)
+	}
+
+	header := records[0]
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]string, len(header))
+		for i, key := range header {
+			row[key] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// renderTemplateRows renders one payload per batch of batchRows rows.
+func renderTemplateRows(tmplText string, rows []map[string]string, batchRows int) ([]string, error) {
+	tmpl, err := template.New("edit-config").Option("missingkey=error").Parse(tmplText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	if batchRows < 1 {
+		batchRows = 1
+	}
+
+	var payloads []string
+	for i := 0; i < len(rows); i += batchRows {
+		batch := rows[i:min(i+batchRows, len(rows))]
+
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, templateData{Row: batch[0], Rows: batch}); err != nil {
+			return nil, fmt.Errorf("failed to render template for row %d: %v", i+1, err)
+		}
+		payloads = append(payloads, removeEmptyLines(b.String()))
+	}
+	return payloads, nil
+}
+
+func templatePayloads(config Config) ([]string, error) {
+	tmplText, err := os.ReadFile(config.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template file %s: %v", config.Template, err)
+	}
+	rows, err := readCSVRows(config.CSV)
+	if err != nil {
+		return nil, err
+	}
+	return renderTemplateRows(string(tmplText), rows, config.BatchRows)
+}
+
+// loadRPCTemplates parses every *.tmpl/*.xml file in dir as a named RPC template, named after the file without its extension.
+// All templates are parsed up front so a broken one is reported even if it isn't the one being invoked.
+func loadRPCTemplates(dir string) (*template.Template, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates directory %s: %v", dir, err)
+	}
+
+	root := template.New("").Option("missingkey=error")
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".tmpl" && ext != ".xml") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %v", entry.Name(), err)
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if root.Lookup(name) != nil {
+			return nil, fmt.Errorf("duplicate template name %q in %s", name, dir)
+		}
+		if _, err := root.New(name).Parse(string(data)); err != nil {
+			return nil, fmt.Errorf("invalid template %s: %v", entry.Name(), err)
+		}
+	}
+	return root, nil
+}
+
+// renderRPCTemplate executes the named template with the given -var values.
+func renderRPCTemplate(templates *template.Template, name string, vars map[string]string) (string, error) {
+	tmpl := templates.Lookup(name)
+	if tmpl == nil {
+		return "", fmt.Errorf("no RPC template named %q", name)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("failed to render RPC template %q: %v", name, err)
+	}
+	return removeEmptyLines(b.String()), nil
+}
+
+// parseVars turns repeated -var key=value flags into a map.
+func parseVars(list []string) (map[string]string, error) {
+	vars := make(map[string]string, len(list))
+	for _, kv := range list {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid -var %q; expected key=value", kv)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+func rpcTemplatePayload(config Config) (string, error) {
+	templates, err := loadRPCTemplates(config.TemplatesDir)
+	if err != nil {
+		return "", err
+	}
+	vars, err := parseVars(config.Vars)
+	if err != nil {
+		return "", err
+	}
+	return renderRPCTemplate(templates, config.RPCTemplate, vars)
+}
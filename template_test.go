@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const vlanTemplate = `<config><vlans xmlns="urn:example:vlan">
+{{range .Rows}}<vlan><id>{{.id}}</id><name>{{.name}}</name></vlan>
+{{end}}</vlans></config>`
+
+// TestTemplatePayloads renders a CSV of two rows, one with a quoted name holding a comma and a doubled quote,
+// one payload per row and then both rows batched into one.
+func TestTemplatePayloads(t *testing.T) {
+	dir := t.TempDir()
+	tmplPath, csvPath := filepath.Join(dir, "vlan.tmpl"), filepath.Join(dir, "vlans.csv")
+	if err := os.WriteFile(tmplPath, []byte(vlanTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	csv := "id,name\n100,users\n200,\"voice, \"\"floor 2\"\"\"\n"
+	if err := os.WriteFile(csvPath, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		batchRows int
+		want      []string
+	}{
+		{"one per row", 1, []string{
+			"<config><vlans xmlns=\"urn:example:vlan\">\n<vlan><id>100</id><name>users</name></vlan>\n</vlans></config>",
+			"<config><vlans xmlns=\"urn:example:vlan\">\n<vlan><id>200</id><name>voice, \"floor 2\"</name></vlan>\n</vlans></config>",
+		}},
+		{"batched", 2, []string{
+			"<config><vlans xmlns=\"urn:example:vlan\">\n<vlan><id>100</id><name>users</name></vlan>\n" +
+				"<vlan><id>200</id><name>voice, \"floor 2\"</name></vlan>\n</vlans></config>",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validConfig(func(c *Config) { c.Template, c.CSV, c.BatchRows = tmplPath, csvPath, tt.batchRows })
+			got, err := templatePayloads(config)
+			if err != nil {
+				t.Fatalf("templatePayloads: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("payloads = %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRPCTemplatePayload loads a templates directory and renders one template by name with -var values.
+func TestRPCTemplatePayload(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"show-interfaces.tmpl": `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get><filter type="subtree">` + "\n" +
+			`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>{{.intf}}</name></interface></interfaces>` + "\n\n" +
+			`</filter></get></rpc>`,
+		"lock.xml":  `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><lock><target><{{.target}}/></target></lock></rpc>`,
+		"notes.txt": `not a template {{`,
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		vars    []string
+		want    string
+		wantErr string
+	}{
+		{"show-interfaces", []string{"intf=eth0"}, `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><get><filter type="subtree">` + "\n" +
+			`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>eth0</name></interface></interfaces>` + "\n" +
+			`</filter></get></rpc>`, ""},
+		{"lock", []string{"target=candidate"}, `<rpc xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><lock><target><candidate/></target></lock></rpc>`, ""},
+		{"show-interfaces", nil, "", `map has no entry for key "intf"`},
+		{"show-interfaces", []string{"intf"}, "", `invalid -var "intf"; expected key=value`},
+		{"notes", nil, "", `no RPC template named "notes"`},
+	}
+	for _, tt := range tests {
+		config := validConfig(func(c *Config) { c.TemplatesDir, c.RPCTemplate, c.Vars = dir, tt.name, tt.vars })
+		got, err := rpcTemplatePayload(config)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s %q: error = %v, want %q", tt.name, tt.vars, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.name, tt.vars, err)
+		} else if got != tt.want {
+			t.Errorf("%s %q = %q, want %q", tt.name, tt.vars, got, tt.want)
+		}
+	}
+}
+
+// TestLoadRPCTemplatesInvalid checks a broken template is reported when the directory is loaded, even if a
+// different template is the one being invoked.
+func TestLoadRPCTemplatesInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{"good.tmpl": `<get/>`, "broken.tmpl": `<get>{{.x</get>`} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := loadRPCTemplates(dir); err == nil || !strings.Contains(err.Error(), "invalid template broken.tmpl") {
+		t.Errorf("loadRPCTemplates error = %v, want broken.tmpl reported", err)
+	}
+}